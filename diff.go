@@ -0,0 +1,309 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"file-counter/pkg/scanner"
+	"file-counter/pkg/scanner/analyzer"
+	"file-counter/pkg/scanner/diff"
+	"file-counter/pkg/scanner/report"
+	"file-counter/pkg/scanner/snapshot"
+	"file-counter/pkg/scanner/types"
+)
+
+// runDiff implements "fs diff OLD [NEW | path ...]": it compares a snapshot
+// with another snapshot, or with a scan of the live tree.
+func runDiff(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	topN := flags.Int("top", 20, "number of directories, extensions and files listed in each section")
+	format := flags.String("format", "text", "output format: text or json")
+	sizeMode := flags.String("size-mode", types.SizeApparent, "size compared: apparent (file length) or disk (allocated blocks)")
+	quiet := flags.Bool("quiet", false, "suppress progress output while scanning the live tree")
+	flags.BoolVar(quiet, "q", false, "shorthand for -quiet")
+	flags.Usage = func() {
+		out := flags.Output()
+		fmt.Fprintf(out, "Usage: %s diff [flags] OLD.fss [NEW.fss | path ...]\n\n", os.Args[0])
+		fmt.Fprintf(out, "Compares a snapshot saved with -save to another snapshot, or to a scan of\n")
+		fmt.Fprintf(out, "the given paths. Without a second argument the snapshot's own roots are\n")
+		fmt.Fprintf(out, "scanned again. Paths are scanned with the options the snapshot was saved\n")
+		fmt.Fprintf(out, "with, such as -exclude and -symlinks.\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	switch *format {
+	case "text", "json":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown output format %q\n", *format)
+		os.Exit(2)
+	}
+
+	switch *sizeMode {
+	case types.SizeApparent, types.SizeDisk:
+	default:
+		fmt.Fprintf(os.Stderr, "unknown size mode %q\n", *sizeMode)
+		os.Exit(2)
+	}
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	status := os.Stdout
+	if *format != "text" {
+		status = os.Stderr
+	}
+
+	before, err := loadDiffSide(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading snapshot: %v\n", err)
+		os.Exit(1)
+	}
+
+	var after diffSide
+	paths := flags.Args()[1:]
+	if len(paths) == 1 {
+		if info, err := os.Stat(paths[0]); err == nil && !info.IsDir() {
+			after, err = loadDiffSide(paths[0])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading snapshot: %v\n", err)
+				os.Exit(1)
+			}
+			paths = nil
+		}
+	}
+	if after.source == "" {
+		if len(paths) == 0 {
+			paths = before.tree.Roots
+		}
+		if len(paths) == 0 {
+			fmt.Fprintf(os.Stderr, "%s was made from a path list; give the paths to compare it with\n", before.source)
+			os.Exit(2)
+		}
+		after = scanDiffSide(paths, before.options, *quiet, status)
+	}
+
+	result := diff.Compare(before.tree, after.tree, *sizeMode)
+
+	if *format == "json" {
+		if err := report.WriteDiffJSON(os.Stdout, result, before.jsonSource(), after.jsonSource()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON output: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	displayDiff(result, before, after, *topN)
+}
+
+// diffSide is one side of a diff and where it came from. options are the
+// scan options of a snapshot.
+type diffSide struct {
+	source  string
+	scanned time.Time
+	tree    diff.Tree
+	options scanner.Options
+}
+
+func (s diffSide) jsonSource() report.JSONDiffSource {
+	return report.JSONDiffSource{Source: s.source, Roots: s.tree.Roots, Scanned: s.scanned}
+}
+
+func (s diffSide) describe() string {
+	when := s.scanned.Format("2006-01-02 15:04:05")
+	if roots := strings.Join(s.tree.Roots, " "); roots != "" && roots != s.source {
+		return fmt.Sprintf("%s (%s, scanned %s)", s.source, roots, when)
+	}
+	return fmt.Sprintf("%s (scanned %s)", s.source, when)
+}
+
+func loadDiffSide(name string) (diffSide, error) {
+	snap, err := snapshot.ReadFile(name)
+	if err != nil {
+		return diffSide{}, err
+	}
+	return diffSide{
+		source:  name,
+		scanned: snap.Created,
+		tree:    diff.Tree{Roots: snap.Roots(), Entries: snap.Entries},
+		options: snap.ScanOptions(),
+	}, nil
+}
+
+// scanDiffSide scans paths with opts, the options of the snapshot it is
+// compared with, so both sides leave out the same entries. The paths are
+// made absolute, as snapshots store them, so the two sides line up. A
+// partial scan would show everything it didn't reach as removed, so an
+// interrupt exits.
+func scanDiffSide(paths []string, opts scanner.Options, quiet bool, status *os.File) diffSide {
+	if !quiet {
+		fmt.Fprintf(status, "Scanning %s\n", strings.Join(paths, " "))
+	}
+
+	absPaths := make([]string, len(paths))
+	for i, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolving %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		absPaths[i] = abs
+	}
+
+	var mu sync.Mutex
+	var entries []types.FileInfo
+	opts.Quiet = quiet
+	opts.ProgressWriter = status
+	opts.Visitor = func(info types.FileInfo) {
+		mu.Lock()
+		entries = append(entries, info)
+		mu.Unlock()
+	}
+	fileScanner := scanner.NewScannerWithOptions(opts)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		fileScanner.Stop()
+		fmt.Fprintln(os.Stderr, "\nScan interrupted; nothing compared")
+		os.Exit(130)
+	}()
+
+	scanned := time.Now()
+	result := fileScanner.Start(absPaths...)
+	signal.Stop(sigChan)
+	if !quiet {
+		fmt.Fprintln(status)
+	}
+
+	var roots []string
+	for _, root := range result.Roots {
+		if root.CoveredBy == "" {
+			roots = append(roots, root.Path)
+		}
+	}
+	return diffSide{
+		source:  strings.Join(paths, " "),
+		scanned: scanned,
+		tree:    diff.Tree{Roots: roots, Entries: entries},
+	}
+}
+
+func displayDiff(result *diff.Result, before, after diffSide, topN int) {
+	fmt.Printf("\n                    FILE SYSTEM DIFF\n\n")
+
+	fmt.Printf("OLD                  %s\n", before.describe())
+	fmt.Printf("NEW                  %s\n", after.describe())
+	fmt.Printf("TOTAL FILES          %d -> %d (%+d)\n", result.OldFiles, result.NewFiles, result.NewFiles-result.OldFiles)
+	fmt.Printf("TOTAL SIZE           %s -> %s (%s)\n", formatBytes(result.OldSize), formatBytes(result.NewSize), formatDelta(result.Delta()))
+	if result.SizeMode == types.SizeDisk {
+		fmt.Printf("SIZE MODE            disk usage\n")
+	}
+	if result.Relative {
+		fmt.Printf("PATHS                relative to the scan root\n")
+	}
+	fmt.Println()
+
+	if len(result.Added)+len(result.Removed)+len(result.Modified) == 0 {
+		fmt.Printf("No files were added, removed or modified.\n")
+		return
+	}
+
+	if len(result.Directories) > 0 {
+		displayDirectoryChanges(result.Directories, topN)
+	}
+	if len(result.Extensions) > 0 {
+		displayExtensionChanges(result.Extensions, topN)
+	}
+
+	displayFileChanges("ADDED", result.Added, topN, false)
+	displayFileChanges("REMOVED", result.Removed, topN, false)
+	displayFileChanges("MODIFIED", result.Modified, topN, true)
+}
+
+func displayDirectoryChanges(changes []diff.DirectoryChange, topN int) {
+	if len(changes) > topN {
+		changes = changes[:topN]
+	}
+	pathWidth := len("DIRECTORY")
+	for _, c := range changes {
+		if len(c.Path) > pathWidth {
+			pathWidth = len(c.Path)
+		}
+	}
+	if pathWidth > 60 {
+		pathWidth = 60
+	}
+
+	fmt.Printf("%-*s %-11s %-11s %-12s %-9s\n", pathWidth, "DIRECTORY", "OLD SIZE", "NEW SIZE", "CHANGE", "FILES")
+	fmt.Printf("%s %s %s %s %s\n", strings.Repeat("-", pathWidth), strings.Repeat("-", 11), strings.Repeat("-", 11), strings.Repeat("-", 12), strings.Repeat("-", 9))
+	for _, c := range changes {
+		displayPath := c.Path
+		if len(displayPath) > pathWidth {
+			displayPath = "..." + displayPath[len(displayPath)-pathWidth+3:]
+		}
+		fmt.Printf("%-*s %-11s %-11s %-12s %+-9d\n", pathWidth, displayPath, formatBytes(c.OldSize), formatBytes(c.NewSize), formatDelta(c.Delta()), c.NewFiles-c.OldFiles)
+	}
+	fmt.Printf("Directory sizes include everything below them.\n\n")
+}
+
+func displayExtensionChanges(changes []diff.ExtensionChange, topN int) {
+	if len(changes) > topN {
+		changes = changes[:topN]
+	}
+	extWidth := len("EXTENSION")
+	for _, c := range changes {
+		if len(c.Extension) > extWidth {
+			extWidth = len(c.Extension)
+		}
+	}
+
+	fmt.Printf("%-*s %-10s %-11s %-11s %-12s %-9s\n", extWidth, "EXTENSION", "CATEGORY", "OLD SIZE", "NEW SIZE", "CHANGE", "FILES")
+	fmt.Printf("%s %s %s %s %s %s\n", strings.Repeat("-", extWidth), strings.Repeat("-", 10), strings.Repeat("-", 11), strings.Repeat("-", 11), strings.Repeat("-", 12), strings.Repeat("-", 9))
+	for _, c := range changes {
+		fmt.Printf("%-*s %-10s %-11s %-11s %-12s %+-9d\n", extWidth, c.Extension, analyzer.GetFileCategory(c.Extension), formatBytes(c.OldSize), formatBytes(c.NewSize), formatDelta(c.Delta()), c.NewCount-c.OldCount)
+	}
+	fmt.Println()
+}
+
+// displayFileChanges lists the largest changes of one kind; the JSON report
+// has all of them.
+func displayFileChanges(title string, changes []diff.FileChange, topN int, sizes bool) {
+	if len(changes) == 0 {
+		return
+	}
+	var total int64
+	for _, c := range changes {
+		total += c.Delta()
+	}
+	fmt.Printf("%-20s %d files (%s)\n", title, len(changes), formatDelta(total))
+	for i, c := range changes {
+		if i == topN {
+			fmt.Printf("                     ... %d more\n", len(changes)-topN)
+			break
+		}
+		if sizes {
+			fmt.Printf("                     %-12s %s (%s -> %s)\n", formatDelta(c.Delta()), c.Path, formatBytes(c.OldSize), formatBytes(c.NewSize))
+			continue
+		}
+		fmt.Printf("                     %-12s %s\n", formatDelta(c.Delta()), c.Path)
+	}
+	fmt.Println()
+}
+
+// formatDelta formats a change in bytes with its sign.
+func formatDelta(bytes int64) string {
+	if bytes < 0 {
+		return "-" + formatBytes(-bytes)
+	}
+	return "+" + formatBytes(bytes)
+}
@@ -1,3 +1,11 @@
 module file-counter
 
 go 1.21
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0
+	github.com/ulikunitz/xz v0.5.15
+	golang.org/x/crypto v0.33.0
+)
+
+require golang.org/x/sys v0.30.0 // indirect
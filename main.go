@@ -1,47 +1,352 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"file-counter/pkg/scanner"
 	"file-counter/pkg/scanner/analyzer"
+	"file-counter/pkg/scanner/dupes"
+	"file-counter/pkg/scanner/ignore"
+	"file-counter/pkg/scanner/report"
+	"file-counter/pkg/scanner/snapshot"
 	"file-counter/pkg/scanner/types"
 )
 
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			*l = append(*l, part)
+		}
+	}
+	return nil
+}
+
+// byteSize is a flag holding a number of bytes, with an optional K, M, G or
+// T suffix in powers of 1024.
+type byteSize int64
+
+func (b *byteSize) String() string {
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *byteSize) Set(value string) error {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	multiplier := int64(1)
+	if i := len(s) - 1; i >= 0 {
+		if exp := strings.IndexByte("KMGT", s[i]); exp >= 0 {
+			multiplier = int64(1) << (10 * (exp + 1))
+			s = s[:i]
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q", value)
+	}
+	*b = byteSize(n * multiplier)
+	return nil
+}
+
 func main() {
-	var scanPath string
-	if len(os.Args) > 1 {
-		scanPath = os.Args[1]
-	} else {
-		scanPath = "."
-		fmt.Printf("Scanning current directory: %s\n", scanPath)
+	// A directory called diff can still be scanned as ./diff.
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		runDiff(os.Args[2:])
+		return
+	}
+
+	defaults := scanner.DefaultOptions()
+
+	var excludes, includes, skipFSTypes stringList
+	workers := flag.Int("workers", defaults.Workers, "number of worker goroutines")
+	walkers := flag.Int("walkers", 0, "number of goroutines reading directories in parallel (default: same as -workers)")
+	topN := flag.Int("top", defaults.TopN, "number of entries in the extension and directory rankings")
+	format := flag.String("format", "text", "output format: text, json, csv, tsv, ndjson or sums (a checksum list for sha256sum -c and friends)")
+	table := flag.String("table", report.TableExtensions, "table written by the csv and tsv formats: "+strings.Join(report.Tables, ", "))
+	sizeMode := flag.String("size-mode", defaults.SizeMode, "size used for extremes and rankings: apparent (file length) or disk (allocated blocks)")
+	sortDirs := flag.String("sort-dirs", defaults.DirectorySort, "rank directories by their direct size or by their whole subtree: direct or recursive")
+	symlinks := flag.String("symlinks", defaults.Symlinks, "symbolic links: skip, physical (count them as links) or follow")
+	ignoreFiles := flag.Bool("ignore-files", false, "honor .gitignore, .ignore and .fsscanignore files; replaces the built-in directory list with .git")
+	maxDepth := flag.Int("max-depth", 0, "list directories at most this deep below the scan path, folding deeper subtrees into their totals (0 = unlimited)")
+	oneFileSystem := flag.Bool("one-file-system", false, "don't descend into directories on other filesystems")
+	flag.BoolVar(oneFileSystem, "x", false, "shorthand for -one-file-system")
+	filesFrom := flag.String("files-from", "", "scan the paths listed in this file (- for stdin) instead of walking a directory")
+	nulSeparated := flag.Bool("0", false, "paths in -files-from are separated by NUL bytes, as from find -print0")
+	duplicates := flag.Bool("duplicates", false, "find files with identical contents (by size, partial hash and SHA-256)")
+	duplicatesMinSize := flag.Int64("duplicates-min-size", 1, "ignore files smaller than this many bytes when looking for duplicates")
+	hashAlgorithm := flag.String("hash", "", "compute a digest of every file: "+strings.Join(scanner.HashAlgorithms, ", ")+" (default sha256 with -format sums)")
+	var hashRate byteSize
+	flag.Var(&hashRate, "hash-rate", "read at most this many bytes per second while hashing, e.g. 50M (0 = unlimited)")
+	save := flag.String("save", "", "save an index of every scanned path to this snapshot file, e.g. scan.fss")
+	load := flag.String("load", "", "report on a snapshot saved with -save instead of scanning")
+	archives := flag.Bool("archives", false, "list the contents of tar, tar.gz, tar.xz and zip files")
+	quiet := flag.Bool("quiet", false, "suppress progress output")
+	flag.BoolVar(quiet, "q", false, "shorthand for -quiet")
+	flag.Var(&excludes, "exclude", "glob pattern to exclude; matched against the name, or the path relative to the scan root if it contains a slash (repeatable, comma separated)")
+	flag.Var(&includes, "include", "glob pattern to keep even if an exclude or built-in rule matches it (repeatable, comma separated)")
+	flag.Var(&skipFSTypes, "skip-fstype", "skip mount points with these filesystem types or classes (pseudo, memory, overlay, network, fuse), e.g. tmpfs,nfs (repeatable, comma separated)")
+	noDefaultExcludes := flag.Bool("no-default-excludes", false, "don't skip the built-in directories (node_modules, .git, build, vendor, cache, ...)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [path ...]\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s diff [flags] OLD.fss [NEW.fss | path ...]\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	switch *format {
+	case "text", "json", "csv", "tsv", "ndjson", "sums":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown output format %q\n", *format)
+		os.Exit(2)
+	}
+
+	switch *sizeMode {
+	case types.SizeApparent, types.SizeDisk:
+	default:
+		fmt.Fprintf(os.Stderr, "unknown size mode %q\n", *sizeMode)
+		os.Exit(2)
+	}
+
+	switch *sortDirs {
+	case types.DirSortDirect, types.DirSortRecursive:
+	default:
+		fmt.Fprintf(os.Stderr, "unknown directory sort %q\n", *sortDirs)
+		os.Exit(2)
+	}
+
+	if *format == "sums" && *hashAlgorithm == "" {
+		*hashAlgorithm = "sha256"
+	}
+	if *hashAlgorithm != "" {
+		known := false
+		for _, algorithm := range scanner.HashAlgorithms {
+			known = known || algorithm == *hashAlgorithm
+		}
+		if !known {
+			fmt.Fprintf(os.Stderr, "unknown hash algorithm %q\n", *hashAlgorithm)
+			os.Exit(2)
+		}
+	}
+
+	switch *symlinks {
+	case types.SymlinkSkip, types.SymlinkPhysical, types.SymlinkFollow:
+	default:
+		fmt.Fprintf(os.Stderr, "unknown symlink mode %q\n", *symlinks)
+		os.Exit(2)
+	}
+
+	switch *table {
+	case report.TableExtensions, report.TableDirectories, report.TableAllExtensions:
+	default:
+		fmt.Fprintf(os.Stderr, "unknown table %q\n", *table)
+		os.Exit(2)
+	}
+
+	scanPaths := []string{"."}
+	if flag.NArg() > 0 {
+		scanPaths = flag.Args()
+	}
+	scanPath := strings.Join(scanPaths, " ")
+
+	if *load != "" {
+		switch {
+		case flag.NArg() > 0, *filesFrom != "":
+			fmt.Fprintln(os.Stderr, "-load can't be combined with paths to scan")
+			os.Exit(2)
+		case *save != "", *duplicates, *hashAlgorithm != "" && *format != "sums":
+			fmt.Fprintln(os.Stderr, "-load can't be combined with -save, -duplicates or -hash")
+			os.Exit(2)
+		}
+	}
+
+	var pathList *os.File
+	if *filesFrom != "" {
+		if flag.NArg() > 0 {
+			fmt.Fprintln(os.Stderr, "-files-from can't be combined with paths to scan")
+			os.Exit(2)
+		}
+		pathList = os.Stdin
+		scanPath = "paths from stdin"
+		if *filesFrom != "-" {
+			f, err := os.Open(*filesFrom)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error opening path list: %v\n", err)
+				os.Exit(1)
+			}
+			defer f.Close()
+			pathList = f
+			scanPath = "paths from " + *filesFrom
+		}
+	}
+
+	// Keep stdout clean for machine-readable formats.
+	status := os.Stdout
+	if *format != "text" {
+		status = os.Stderr
+	}
+
+	if !*quiet {
+		switch {
+		case *load != "":
+			fmt.Fprintf(status, "Loading snapshot %s\n", *load)
+		case pathList != nil:
+			fmt.Fprintf(status, "Scanning %s\n", scanPath)
+		case scanPath == ".":
+			fmt.Fprintf(status, "Scanning current directory: %s\n", scanPath)
+		case len(scanPaths) > 1:
+			fmt.Fprintf(status, "Scanning directories: %s\n", scanPath)
+		default:
+			fmt.Fprintf(status, "Scanning directory: %s\n", scanPath)
+		}
+	}
+
+	var visitors []func(types.FileInfo)
+	var records *report.RecordWriter
+	if *format == "ndjson" {
+		records = report.NewRecordWriter(os.Stdout)
+		visitors = append(visitors, records.Write)
+	}
+
+	var sums *report.SumsWriter
+	if *format == "sums" {
+		sums = report.NewSumsWriter(os.Stdout)
+		visitors = append(visitors, sums.Write)
+	}
+
+	var finder *dupes.Finder
+	if *duplicates {
+		finder = dupes.NewFinder(scanner.OSFS{}, *duplicatesMinSize)
+		visitors = append(visitors, finder.Add)
+	}
+
+	var saver *snapshot.Writer
+	var saveFile *os.File
+	if *save != "" {
+		f, err := os.Create(*save)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating snapshot: %v\n", err)
+			os.Exit(1)
+		}
+		saveFile = f
+		saver, err = snapshot.NewWriter(f)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing snapshot: %v\n", err)
+			os.Exit(1)
+		}
+		visitors = append(visitors, saver.Add)
+	}
+
+	var visitor func(types.FileInfo)
+	switch len(visitors) {
+	case 0:
+	case 1:
+		visitor = visitors[0]
+	default:
+		visitor = func(info types.FileInfo) {
+			for _, visit := range visitors {
+				visit(info)
+			}
+		}
+	}
+
+	if *load != "" {
+		snap, err := snapshot.ReadFile(*load)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading snapshot: %v\n", err)
+			os.Exit(1)
+		}
+		collector := analyzer.NewStatisticsCollector()
+		collector.SetTopN(*topN)
+		collector.SetDirectorySort(*sortDirs)
+		// Report the way the scan did unless told otherwise.
+		collector.SetSizeMode(snap.SizeMode())
+		collector.SetMaxDepth(snap.MaxDepth())
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "size-mode":
+				collector.SetSizeMode(*sizeMode)
+			case "max-depth":
+				collector.SetMaxDepth(*maxDepth)
+			}
+		})
+		result := snap.Result(collector)
+		if visitor != nil {
+			for _, entry := range snap.Entries {
+				visitor(entry)
+			}
+		}
+		if roots := snap.Roots(); len(roots) > 0 {
+			scanPath = strings.Join(roots, " ")
+		} else {
+			scanPath = "paths listed in " + *load
+		}
+		writeResult(result, scanPath, *format, *table, records, sums)
+		return
 	}
 
-	if scanPath != "." {
-		fmt.Printf("Scanning directory: %s\n", scanPath)
+	var ignoreFileNames []string
+	if *ignoreFiles {
+		ignoreFileNames = ignore.DefaultFileNames
 	}
 
-	fileScanner := scanner.NewScanner()
+	options := scanner.Options{
+		Workers:           *workers,
+		Walkers:           *walkers,
+		TopN:              *topN,
+		DirectorySort:     *sortDirs,
+		SizeMode:          *sizeMode,
+		Symlinks:          *symlinks,
+		Excludes:          excludes,
+		Includes:          includes,
+		NoDefaultExcludes: *noDefaultExcludes,
+		SkipFSTypes:       skipFSTypes,
+		IgnoreFiles:       ignoreFileNames,
+		MaxDepth:          *maxDepth,
+		OneFileSystem:     *oneFileSystem,
+		Archives:          *archives,
+		Hash:              *hashAlgorithm,
+		HashRate:          int64(hashRate),
+		Quiet:             *quiet,
+		ProgressWriter:    status,
+		Visitor:           visitor,
+	}
+	fileScanner := scanner.NewScannerWithOptions(options)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
 	resultChan := make(chan *types.ScanResult, 1)
 	go func() {
-		result := fileScanner.Start(scanPath)
+		if pathList == nil {
+			resultChan <- fileScanner.Start(scanPaths...)
+			return
+		}
+		result, err := fileScanner.StartFromList(pathList, *nulSeparated)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading path list: %v\n", err)
+		}
 		resultChan <- result
 	}()
 
 	var result *types.ScanResult
+	interrupted := false
 	select {
 	case <-sigChan:
-		fmt.Println("\nReceived interrupt signal. Stopping scan...")
+		fmt.Fprintln(status, "\nReceived interrupt signal. Stopping scan...")
 		fileScanner.Stop()
+		interrupted = true
 		select {
 		case result = <-resultChan:
 		case <-make(chan struct{}):
@@ -49,10 +354,78 @@ func main() {
 	case result = <-resultChan:
 	}
 
-	displayResults(result, scanPath)
+	if status != os.Stdout && !*quiet {
+		fmt.Fprintln(status)
+	}
+
+	// Hashing can take far longer than the scan, so an interrupted scan
+	// skips it.
+	if finder != nil && !interrupted {
+		if !*quiet {
+			fmt.Fprintf(status, "\nLooking for duplicate files...\n")
+		}
+		stats := finder.Find()
+		result.Duplicates = &stats
+	}
+
+	// A partial snapshot would look like a tree that lost files, so an
+	// interrupted scan isn't saved.
+	if saver != nil {
+		err := saver.Close(result, options)
+		if closeErr := saveFile.Close(); err == nil {
+			err = closeErr
+		}
+		switch {
+		case interrupted:
+			os.Remove(*save)
+			fmt.Fprintf(os.Stderr, "Scan interrupted; snapshot %s not saved\n", *save)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Error writing snapshot: %v\n", err)
+			os.Exit(1)
+		case !*quiet:
+			fmt.Fprintf(status, "Saved snapshot to %s\n", *save)
+		}
+	}
+
+	writeResult(result, scanPath, *format, *table, records, sums)
+}
+
+// writeResult writes the result in the chosen format. The ndjson and sums
+// writers have received their records already and are only flushed.
+func writeResult(result *types.ScanResult, scanPath, format, table string, records *report.RecordWriter, sums *report.SumsWriter) {
+	switch format {
+	case "json":
+		if err := report.WriteJSON(os.Stdout, result, scanPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON output: %v\n", err)
+			os.Exit(1)
+		}
+	case "csv", "tsv":
+		comma := ','
+		if format == "tsv" {
+			comma = '\t'
+		}
+		if err := report.WriteDelimited(os.Stdout, result, comma, table); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s output: %v\n", strings.ToUpper(format), err)
+			os.Exit(1)
+		}
+	case "ndjson":
+		if err := records.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing NDJSON output: %v\n", err)
+			os.Exit(1)
+		}
+	case "sums":
+		if err := sums.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing checksums: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		displayResults(result, scanPath)
+	}
 }
 
 func displayResults(result *types.ScanResult, scanPath string) {
+	mode := result.SizeMode
+
 	// Display header
 	fmt.Printf("\n                    FILE SYSTEM SCAN RESULTS\n\n")
 
@@ -61,6 +434,7 @@ func displayResults(result *types.ScanResult, scanPath string) {
 	fmt.Printf("TOTAL FILES          %d files\n", result.TotalFiles)
 	fmt.Printf("TOTAL DIRECTORIES    %d directories\n", result.TotalDirs)
 	fmt.Printf("TOTAL SIZE           %s\n", formatBytes(result.TotalSize))
+	fmt.Printf("DISK USAGE           %s\n", formatBytes(result.TotalDiskUsage))
 	fmt.Printf("SCAN DURATION        %s\n", result.ScanDuration.Round(time.Millisecond).String())
 	fmt.Printf("AVERAGE FILE SIZE    %s\n", formatBytes(int64(result.AverageFileSize)))
 	fmt.Printf("PROCESSING SPEED     %.2f\n", result.FilesPerSecond)
@@ -68,12 +442,92 @@ func displayResults(result *types.ScanResult, scanPath string) {
 
 	// File extremes
 	if result.TotalFiles > 0 {
-		fmt.Printf("LARGEST FILE         %s (%s)\n", result.LargestFile.Path, formatBytes(result.LargestFile.Size))
-		fmt.Printf("SMALLEST FILE        %s (%s)\n", result.SmallestFile.Path, formatBytes(result.SmallestFile.Size))
+		if result.LargestFile.Path != "" {
+			fmt.Printf("LARGEST FILE         %s (%s)\n", result.LargestFile.Path, formatBytes(result.LargestFile.SizeFor(mode)))
+		}
+		if result.SmallestFile.Path != "" {
+			fmt.Printf("SMALLEST FILE        %s (%s)\n", result.SmallestFile.Path, formatBytes(result.SmallestFile.SizeFor(mode)))
+		}
 		fmt.Printf("OLDEST FILE          %s (%s)\n", result.OldestFile.Path, result.OldestFile.ModTime.Format("2006-01-02 15:04:05"))
 		fmt.Printf("NEWEST FILE          %s (%s)\n\n", result.NewestFile.Path, result.NewestFile.ModTime.Format("2006-01-02 15:04:05"))
 	}
 
+	// Per-root breakdown
+	if len(result.Roots) > 1 {
+		displayRoots(result.Roots, mode)
+	}
+
+	// Hard links
+	if result.HardLinks.LinkedFiles > 0 {
+		fmt.Printf("HARD-LINKED FILES    %d files (%d unique inodes)\n", result.HardLinks.LinkedFiles, result.HardLinks.UniqueInodes)
+		fmt.Printf("DUPLICATE LINKS      %d links\n", result.HardLinks.DuplicateLinks)
+		fmt.Printf("DEDUPLICATED SIZE    %s (%s on disk)\n\n", formatBytes(result.HardLinks.DeduplicatedBytes), formatBytes(result.HardLinks.DeduplicatedDiskUsage))
+	}
+
+	// Symbolic links
+	if result.Symlinks.Links > 0 || result.Symlinks.Followed > 0 {
+		fmt.Printf("SYMLINKS             %d links (%s)", result.Symlinks.Links, formatBytes(result.Symlinks.Bytes))
+		if result.Symlinks.Followed > 0 {
+			fmt.Printf(", %d followed", result.Symlinks.Followed)
+		}
+		fmt.Printf("\n\n")
+	}
+
+	if len(result.BrokenLinks) > 0 {
+		fmt.Printf("BROKEN LINKS         %d links\n", len(result.BrokenLinks))
+		for _, link := range result.BrokenLinks {
+			fmt.Printf("                     %s -> %s (%s)\n", link.Path, link.Target, link.Reason)
+		}
+		fmt.Println()
+	}
+
+	// Archive contents
+	if len(result.Archives) > 0 {
+		displayArchives(result.Archives)
+	}
+
+	// Files with identical contents
+	if result.Duplicates != nil {
+		displayDuplicates(result.Duplicates)
+	}
+
+	// Mount points left out by -one-file-system
+	if len(result.SkippedMounts) > 0 {
+		fmt.Printf("SKIPPED MOUNTS       %d mount points on other filesystems\n", len(result.SkippedMounts))
+		for _, mount := range result.SkippedMounts {
+			fmt.Printf("                     %s\n", mount)
+		}
+		fmt.Println()
+	}
+
+	// Paths the walker didn't enter
+	if len(result.Skipped) > 0 {
+		reasons := map[string]int{}
+		for _, skipped := range result.Skipped {
+			reasons[skipped.Reason]++
+		}
+		fmt.Printf("SKIPPED              %d paths\n", len(result.Skipped))
+		for _, reason := range []string{types.SkipPseudoFS, types.SkipFSType, types.SkipBuiltinRule, types.SkipUserExclude, types.SkipSymlinkLoop, types.SkipAlreadyVisited} {
+			if reasons[reason] > 0 {
+				fmt.Printf("                     %d %s\n", reasons[reason], reason)
+			}
+		}
+		for _, skipped := range result.Skipped {
+			switch {
+			case skipped.FSType != "":
+				fmt.Printf("                     %s (%s)\n", skipped.Path, skipped.FSType)
+			case skipped.Reason == types.SkipPseudoFS:
+				fmt.Printf("                     %s (%s)\n", skipped.Path, skipped.Reason)
+			}
+		}
+		fmt.Println()
+	}
+
+	// Entries left out by ignore files
+	if result.Ignored.Files > 0 || result.Ignored.Dirs > 0 {
+		fmt.Printf("IGNORED              %d files (%s), %d directories not walked\n\n", result.Ignored.Files, formatBytes(result.Ignored.Bytes), result.Ignored.Dirs)
+	}
+
 	// Top extensions
 	if len(result.TopExtensions) > 0 {
 		// Calculate dynamic column widths
@@ -99,7 +553,7 @@ func displayResults(result *types.ScanResult, scanPath string) {
 			if len(countStr) > maxCountWidth {
 				maxCountWidth = len(countStr)
 			}
-			sizeStr := formatBytes(ext.TotalSize)
+			sizeStr := formatBytes(ext.SizeFor(mode))
 			if len(sizeStr) > maxSizeWidth {
 				maxSizeWidth = len(sizeStr)
 			}
@@ -160,7 +614,7 @@ func displayResults(result *types.ScanResult, scanPath string) {
 				extDisplay = extDisplay[:maxExtWidth-3] + "..."
 			}
 			fmt.Printf(rankFormat+extFormat+catFormat+countFormat+sizeFormat+"\n",
-				i+1, extDisplay, category, ext.Count, formatBytes(ext.TotalSize))
+				i+1, extDisplay, category, ext.Count, formatBytes(ext.SizeFor(mode)))
 		}
 		fmt.Printf("\n")
 	}
@@ -173,6 +627,7 @@ func displayResults(result *types.ScanResult, scanPath string) {
 		maxFilesWidth := len("FILES")
 		maxDirsWidth := len("DIRS")
 		maxSizeWidth := len("TOTAL SIZE")
+		maxTreeWidth := len("TREE SIZE")
 
 		for _, dir := range result.TopDirectories {
 			rankStr := fmt.Sprintf("%d", len(result.TopDirectories))
@@ -190,10 +645,14 @@ func displayResults(result *types.ScanResult, scanPath string) {
 			if len(dirsStr) > maxDirsWidth {
 				maxDirsWidth = len(dirsStr)
 			}
-			sizeStr := formatBytes(dir.TotalSize)
+			sizeStr := formatBytes(dir.SizeFor(mode))
 			if len(sizeStr) > maxSizeWidth {
 				maxSizeWidth = len(sizeStr)
 			}
+			treeStr := formatBytes(dir.RecursiveSizeFor(mode))
+			if len(treeStr) > maxTreeWidth {
+				maxTreeWidth = len(treeStr)
+			}
 		}
 
 		// Ensure minimum widths and reasonable maximum
@@ -215,30 +674,36 @@ func displayResults(result *types.ScanResult, scanPath string) {
 		if maxSizeWidth < 11 {
 			maxSizeWidth = 11
 		}
+		if maxTreeWidth < 11 {
+			maxTreeWidth = 11
+		}
 
 		// Build format strings
 		rankFormat := fmt.Sprintf("%%-%dd ", maxRankWidth)
 		pathFormat := fmt.Sprintf("%%-%ds ", maxPathWidth)
 		filesFormat := fmt.Sprintf("%%-%dd ", maxFilesWidth)
 		dirsFormat := fmt.Sprintf("%%-%dd ", maxDirsWidth)
-		sizeFormat := fmt.Sprintf("%%-%ds", maxSizeWidth)
+		sizeFormat := fmt.Sprintf("%%-%ds ", maxSizeWidth)
+		treeFormat := fmt.Sprintf("%%-%ds", maxTreeWidth)
 
 		// Print header
-		header := fmt.Sprintf("%s %s %s %s %s\n",
+		header := fmt.Sprintf("%s %s %s %s %s %s\n",
 			fmt.Sprintf("%-*s", maxRankWidth, "#"),
 			fmt.Sprintf("%-*s", maxPathWidth, "DIRECTORY"),
 			fmt.Sprintf("%-*s", maxFilesWidth, "FILES"),
 			fmt.Sprintf("%-*s", maxDirsWidth, "DIRS"),
-			fmt.Sprintf("%-*s", maxSizeWidth, "TOTAL SIZE"))
+			fmt.Sprintf("%-*s", maxSizeWidth, "TOTAL SIZE"),
+			fmt.Sprintf("%-*s", maxTreeWidth, "TREE SIZE"))
 		fmt.Print(header)
 
 		// Print separator
-		separator := fmt.Sprintf("%s %s %s %s %s\n",
+		separator := fmt.Sprintf("%s %s %s %s %s %s\n",
 			fmt.Sprintf("%-*s", maxRankWidth, strings.Repeat("-", maxRankWidth)),
 			fmt.Sprintf("%-*s", maxPathWidth, strings.Repeat("-", maxPathWidth)),
 			fmt.Sprintf("%-*s", maxFilesWidth, strings.Repeat("-", maxFilesWidth)),
 			fmt.Sprintf("%-*s", maxDirsWidth, strings.Repeat("-", maxDirsWidth)),
-			fmt.Sprintf("%-*s", maxSizeWidth, strings.Repeat("-", maxSizeWidth)))
+			fmt.Sprintf("%-*s", maxSizeWidth, strings.Repeat("-", maxSizeWidth)),
+			fmt.Sprintf("%-*s", maxTreeWidth, strings.Repeat("-", maxTreeWidth)))
 		fmt.Print(separator)
 
 		// Print data
@@ -247,9 +712,138 @@ func displayResults(result *types.ScanResult, scanPath string) {
 			if len(displayPath) > maxPathWidth {
 				displayPath = "..." + displayPath[len(displayPath)-maxPathWidth+3:]
 			}
-			fmt.Printf(rankFormat+pathFormat+filesFormat+dirsFormat+sizeFormat+"\n",
-				i+1, displayPath, dir.FileCount, dir.DirCount, formatBytes(dir.TotalSize))
+			fmt.Printf(rankFormat+pathFormat+filesFormat+dirsFormat+sizeFormat+treeFormat+"\n",
+				i+1, displayPath, dir.FileCount, dir.DirCount, formatBytes(dir.SizeFor(mode)), formatBytes(dir.RecursiveSizeFor(mode)))
+		}
+		if result.MaxDepth > 0 {
+			fmt.Printf("Directories below depth %d are folded into TREE SIZE.\n", result.MaxDepth)
+		}
+		fmt.Printf("\n")
+	}
+
+	// Files per depth below the scan path
+	if len(result.DepthStats) > 0 {
+		displayDepthHistogram(result.DepthStats)
+	}
+}
+
+func displayArchives(archives []types.ArchiveStats) {
+	// Only the archives with the most content are listed; the JSON
+	// report has all of them.
+	const listed = 10
+
+	var files, size, uncompressed int64
+	for _, a := range archives {
+		files += a.Files
+		size += a.Size
+		uncompressed += a.UncompressedSize
+	}
+	fmt.Printf("ARCHIVES             %d archives, %d files, %s unpacked from %s\n", len(archives), files, formatBytes(uncompressed), formatBytes(size))
+	for i, a := range archives {
+		if i == listed {
+			fmt.Printf("                     ... %d more\n", len(archives)-listed)
+			break
+		}
+		if a.Error != "" {
+			fmt.Printf("                     %s (%s, unreadable: %s)\n", a.Path, a.Format, a.Error)
+			continue
+		}
+		fmt.Printf("                     %s (%s, %d files, %s unpacked from %s)\n", a.Path, a.Format, a.Files, formatBytes(a.UncompressedSize), formatBytes(a.Size))
+	}
+	fmt.Println()
+}
+
+func displayDuplicates(d *types.DuplicateStats) {
+	// Only the sets wasting the most space are listed; the JSON report
+	// has all of them.
+	const listed = 10
+
+	fmt.Printf("DUPLICATES           %d sets, %d files, %s wasted\n", len(d.Sets), d.Files, formatBytes(d.WastedBytes))
+	if d.HardLinksSkipped > 0 {
+		fmt.Printf("                     %d hard links or repeated paths not counted as duplicates\n", d.HardLinksSkipped)
+	}
+	if d.Errors > 0 {
+		fmt.Printf("                     %d files couldn't be read\n", d.Errors)
+	}
+	for i, set := range d.Sets {
+		if i == listed {
+			fmt.Printf("                     ... %d more sets\n", len(d.Sets)-listed)
+			break
+		}
+		fmt.Printf("                     %d x %s (%s wasted)\n", len(set.Paths), formatBytes(set.Size), formatBytes(set.WastedBytes))
+		for _, path := range set.Paths {
+			fmt.Printf("                       %s\n", path)
+		}
+	}
+	fmt.Println()
+}
+
+func displayRoots(roots []types.RootStats, mode string) {
+	pathWidth := len("ROOT")
+	for _, root := range roots {
+		if len(root.Path) > pathWidth {
+			pathWidth = len(root.Path)
+		}
+	}
+	if pathWidth > 60 {
+		pathWidth = 60
+	}
+
+	fmt.Printf("%-*s %-10s %-8s %-11s\n", pathWidth, "ROOT", "FILES", "DIRS", "SIZE")
+	fmt.Printf("%s %s %s %s\n", strings.Repeat("-", pathWidth), strings.Repeat("-", 10), strings.Repeat("-", 8), strings.Repeat("-", 11))
+	for _, root := range roots {
+		displayPath := root.Path
+		if len(displayPath) > pathWidth {
+			displayPath = "..." + displayPath[len(displayPath)-pathWidth+3:]
+		}
+		if root.CoveredBy == root.Path {
+			fmt.Printf("%-*s (repeated, not scanned twice)\n", pathWidth, displayPath)
+			continue
+		}
+		if root.CoveredBy != "" {
+			fmt.Printf("%-*s (inside %s, not scanned twice)\n", pathWidth, displayPath, root.CoveredBy)
+			continue
+		}
+		size := root.Size
+		if mode == types.SizeDisk {
+			size = root.DiskUsage
+		}
+		fmt.Printf("%-*s %-10d %-8d %-11s\n", pathWidth, displayPath, root.Files, root.Dirs, formatBytes(size))
+	}
+	fmt.Println()
+}
+
+func displayDepthHistogram(depthStats map[int]int64) {
+	const barWidth = 40
+
+	minDepth, maxDepth := -1, 0
+	var maxFiles int64
+	for depth, files := range depthStats {
+		if minDepth < 0 || depth < minDepth {
+			minDepth = depth
+		}
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		if files > maxFiles {
+			maxFiles = files
+		}
+	}
+
+	countWidth := len(fmt.Sprintf("%d", maxFiles))
+	if countWidth < 7 {
+		countWidth = 7
+	}
+
+	fmt.Printf("%-5s %-*s %s\n", "DEPTH", countWidth, "FILES", "HISTOGRAM")
+	fmt.Printf("%s %s %s\n", strings.Repeat("-", 5), strings.Repeat("-", countWidth), strings.Repeat("-", barWidth))
+	for depth := minDepth; depth <= maxDepth; depth++ {
+		files := depthStats[depth]
+		bar := int(files * barWidth / maxFiles)
+		if bar == 0 && files > 0 {
+			bar = 1
 		}
+		fmt.Printf("%-5d %-*d %s\n", depth, countWidth, files, strings.Repeat("#", bar))
 	}
 }
 
@@ -0,0 +1,73 @@
+package scanner
+
+import (
+	"file-counter/pkg/scanner/analyzer"
+	"file-counter/pkg/scanner/types"
+)
+
+// An analyzer passed in Options only has to be a types.FileAnalyzer. If it
+// also implements any of the interfaces below, the scanner uses them too;
+// analyzer.StatisticsCollector implements all of them.
+
+// Configurable is an analyzer that takes the ranking and size settings from
+// Options.
+type Configurable interface {
+	SetTopN(n int)
+	SetDirectorySort(mode string)
+	SetSizeMode(mode string)
+	SetMaxDepth(depth int)
+}
+
+// TreeAnalyzer is an analyzer that tells directories and symbolic links
+// apart from files and knows the scan roots. Without it, directories are
+// passed to AnalyzeFile with IsDir set and links aren't passed at all.
+type TreeAnalyzer interface {
+	AddRoot(path string)
+	AddCoveredRoot(path, coveredBy string)
+	AnalyzeDirectory(path string, info types.FileInfo) error
+	AnalyzeSymlink(path string, info types.FileInfo) error
+}
+
+// Recorder is an analyzer that keeps track of what the scan left out or
+// couldn't read.
+type Recorder interface {
+	AddSkipped(skipped types.SkippedPath)
+	AddSkippedMount(path string)
+	AddIgnored(isDir bool, size int64)
+	AddBrokenLink(link types.BrokenLink)
+	AddArchive(stats types.ArchiveStats)
+	IncrementError()
+}
+
+// fileTree is the TreeAnalyzer of an analyzer that only knows files.
+type fileTree struct {
+	types.FileAnalyzer
+}
+
+func (fileTree) AddRoot(string)                {}
+func (fileTree) AddCoveredRoot(string, string) {}
+
+func (t fileTree) AnalyzeDirectory(path string, info types.FileInfo) error {
+	return t.AnalyzeFile(path, info)
+}
+
+func (fileTree) AnalyzeSymlink(string, types.FileInfo) error {
+	return nil
+}
+
+// nopRecorder is the Recorder of an analyzer that doesn't record anything.
+type nopRecorder struct{}
+
+func (nopRecorder) AddSkipped(types.SkippedPath)   {}
+func (nopRecorder) AddSkippedMount(string)         {}
+func (nopRecorder) AddIgnored(bool, int64)         {}
+func (nopRecorder) AddBrokenLink(types.BrokenLink) {}
+func (nopRecorder) AddArchive(types.ArchiveStats)  {}
+func (nopRecorder) IncrementError()                {}
+
+var _ interface {
+	types.FileAnalyzer
+	Configurable
+	TreeAnalyzer
+	Recorder
+} = (*analyzer.StatisticsCollector)(nil)
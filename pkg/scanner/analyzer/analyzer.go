@@ -17,6 +17,7 @@ type StatisticsCollector struct {
 	totalFiles  int64
 	totalDirs   int64
 	totalSize   int64
+	totalDisk   int64
 	totalErrors int64
 	startTime   time.Time
 
@@ -28,7 +29,31 @@ type StatisticsCollector struct {
 	extensionStats map[string]*types.ExtensionStats
 	directoryStats map[string]*types.DirectoryStats
 
+	// collapsed holds the totals of everything below maxDepth, keyed by
+	// the directory at the cutoff that the subtree belongs to.
+	collapsed map[string]*types.DirectoryStats
+
 	depthStats map[int]int64
+
+	hardLinks types.HardLinkStats
+	seenLinks map[types.FileID]struct{}
+
+	skippedMounts []string
+	ignored       types.IgnoreStats
+	skipped       []types.SkippedPath
+	symlinks      types.SymlinkStats
+	brokenLinks   []types.BrokenLink
+	archives      []types.ArchiveStats
+
+	topN     int
+	dirSort  string
+	sizeMode string
+	maxDepth int
+	roots    map[string]bool
+
+	// rootStats keeps the roots in the order they were added; the totals
+	// of directory roots are filled in from their recursive stats.
+	rootStats []types.RootStats
 }
 
 func NewStatisticsCollector() *StatisticsCollector {
@@ -36,9 +61,16 @@ func NewStatisticsCollector() *StatisticsCollector {
 		startTime:      time.Now(),
 		extensionStats: make(map[string]*types.ExtensionStats),
 		directoryStats: make(map[string]*types.DirectoryStats),
+		collapsed:      make(map[string]*types.DirectoryStats),
 		depthStats:     make(map[int]int64),
+		seenLinks:      make(map[types.FileID]struct{}),
+		topN:           5,
+		dirSort:        types.DirSortDirect,
+		sizeMode:       types.SizeApparent,
+		roots:          make(map[string]bool),
 		smallestFile: types.FileInfo{
-			Size: int64(^uint64(0) >> 1),
+			Size:      int64(^uint64(0) >> 1),
+			DiskUsage: int64(^uint64(0) >> 1),
 		},
 		oldestFile: types.FileInfo{
 			ModTime: time.Now(),
@@ -46,6 +78,64 @@ func NewStatisticsCollector() *StatisticsCollector {
 	}
 }
 
+func (sc *StatisticsCollector) SetTopN(n int) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if n > 0 {
+		sc.topN = n
+	}
+}
+
+func (sc *StatisticsCollector) SetDirectorySort(mode string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if mode == types.DirSortDirect || mode == types.DirSortRecursive {
+		sc.dirSort = mode
+	}
+}
+
+// SetSizeMode selects whether extremes and directory rankings use apparent
+// sizes (types.SizeApparent) or allocated disk usage (types.SizeDisk).
+func (sc *StatisticsCollector) SetSizeMode(mode string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if mode == types.SizeApparent || mode == types.SizeDisk {
+		sc.sizeMode = mode
+	}
+}
+
+// SetMaxDepth limits the directories that are tracked one by one to those
+// at most depth levels below the root. Anything deeper is still counted,
+// but folded into the recursive totals of its ancestor at the cutoff.
+// Zero means no limit.
+func (sc *StatisticsCollector) SetMaxDepth(depth int) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if depth >= 0 {
+		sc.maxDepth = depth
+	}
+}
+
+// AddRoot marks path as a scan root, so it isn't counted as a subdirectory
+// of its own parent, and gives it its own line in ScanResult.Roots.
+func (sc *StatisticsCollector) AddRoot(path string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	path = filepath.Clean(path)
+	if !sc.roots[path] {
+		sc.roots[path] = true
+		sc.rootStats = append(sc.rootStats, types.RootStats{Path: path})
+	}
+}
+
+// AddCoveredRoot lists a root that wasn't scanned because it lies inside
+// coveredBy, which was.
+func (sc *StatisticsCollector) AddCoveredRoot(path, coveredBy string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.rootStats = append(sc.rootStats, types.RootStats{Path: filepath.Clean(path), CoveredBy: coveredBy})
+}
+
 func (sc *StatisticsCollector) AnalyzeFile(path string, info types.FileInfo) error {
 	sc.mu.Lock()
 	defer sc.mu.Unlock()
@@ -56,15 +146,44 @@ func (sc *StatisticsCollector) AnalyzeFile(path string, info types.FileInfo) err
 	}
 
 	sc.totalFiles++
-	sc.totalSize += info.Size
+	if info.LinkTarget != "" {
+		sc.symlinks.Followed++
+	}
+
+	// Extra names for an inode we've already seen add no new data, so
+	// count the file but not its bytes.
+	bytes, diskBytes := info.Size, info.DiskUsage
+	if info.Links > 1 {
+		sc.hardLinks.LinkedFiles++
+		id := info.ID()
+		if _, seen := sc.seenLinks[id]; seen {
+			sc.hardLinks.DuplicateLinks++
+			sc.hardLinks.DeduplicatedBytes += info.Size
+			sc.hardLinks.DeduplicatedDiskUsage += info.DiskUsage
+			bytes, diskBytes = 0, 0
+		} else {
+			sc.seenLinks[id] = struct{}{}
+			sc.hardLinks.UniqueInodes++
+		}
+	}
+
+	sc.totalSize += bytes
+	sc.totalDisk += diskBytes
+
+	if sc.roots[path] {
+		root := sc.rootStat(path)
+		root.Files++
+		root.Size += bytes
+		root.DiskUsage += diskBytes
+	}
 
-	depth := strings.Count(strings.TrimPrefix(path, "/"), "/")
-	sc.depthStats[depth]++
+	sc.depthStats[info.Depth]++
 
-	if info.Size > sc.largestFile.Size {
+	size := info.SizeFor(sc.sizeMode)
+	if size > sc.largestFile.SizeFor(sc.sizeMode) {
 		sc.largestFile = info
 	}
-	if info.Size < sc.smallestFile.Size && info.Size > 0 {
+	if size < sc.smallestFile.SizeFor(sc.sizeMode) && size > 0 {
 		sc.smallestFile = info
 	}
 
@@ -82,28 +201,30 @@ func (sc *StatisticsCollector) AnalyzeFile(path string, info types.FileInfo) err
 
 	if stat, exists := sc.extensionStats[ext]; exists {
 		stat.Count++
-		stat.TotalSize += info.Size
+		stat.TotalSize += bytes
+		stat.DiskUsage += diskBytes
 	} else {
 		sc.extensionStats[ext] = &types.ExtensionStats{
 			Extension: ext,
 			Count:     1,
-			TotalSize: info.Size,
+			TotalSize: bytes,
+			DiskUsage: diskBytes,
 		}
 	}
 
-	dirPath := filepath.Dir(path)
-	if stat, exists := sc.directoryStats[dirPath]; exists {
+	if cutoff, ok := sc.cutoff(filepath.Dir(path), info.Depth-1); ok {
+		stat := sc.collapsedStat(cutoff)
 		stat.FileCount++
-		stat.TotalSize += info.Size
-	} else {
-		sc.directoryStats[dirPath] = &types.DirectoryStats{
-			Path:      dirPath,
-			FileCount: 1,
-			DirCount:  0,
-			TotalSize: info.Size,
-		}
+		stat.TotalSize += bytes
+		stat.DiskUsage += diskBytes
+		return nil
 	}
 
+	dirStat := sc.directoryStat(filepath.Dir(path))
+	dirStat.FileCount++
+	dirStat.TotalSize += bytes
+	dirStat.DiskUsage += diskBytes
+
 	return nil
 }
 
@@ -112,22 +233,117 @@ func (sc *StatisticsCollector) AnalyzeDirectory(path string, info types.FileInfo
 	defer sc.mu.Unlock()
 
 	sc.totalDirs++
+	if info.LinkTarget != "" {
+		sc.symlinks.Followed++
+	}
 
-	dirPath := path
-	if stat, exists := sc.directoryStats[dirPath]; exists {
-		stat.DirCount++
-	} else {
-		sc.directoryStats[dirPath] = &types.DirectoryStats{
-			Path:      dirPath,
-			FileCount: 0,
-			DirCount:  1,
-			TotalSize: 0,
+	if cutoff, ok := sc.cutoff(filepath.Dir(path), info.Depth-1); ok {
+		sc.collapsedStat(cutoff).DirCount++
+		return nil
+	}
+
+	if sc.maxDepth <= 0 || info.Depth <= sc.maxDepth {
+		sc.directoryStat(path)
+	}
+	if !sc.roots[path] {
+		if parent := filepath.Dir(path); parent != path {
+			sc.directoryStat(parent).DirCount++
 		}
 	}
 
 	return nil
 }
 
+// cutoff returns the ancestor at maxDepth of dir, which is depth levels
+// below the root, if dir is deeper than that.
+func (sc *StatisticsCollector) cutoff(dir string, depth int) (string, bool) {
+	if sc.maxDepth <= 0 || depth <= sc.maxDepth {
+		return "", false
+	}
+	for ; depth > sc.maxDepth; depth-- {
+		dir = filepath.Dir(dir)
+	}
+	return dir, true
+}
+
+func (sc *StatisticsCollector) collapsedStat(path string) *types.DirectoryStats {
+	stat, exists := sc.collapsed[path]
+	if !exists {
+		stat = &types.DirectoryStats{Path: path}
+		sc.collapsed[path] = stat
+	}
+	return stat
+}
+
+// AnalyzeSymlink records a symbolic link that isn't followed. Links are
+// kept out of the file counts and sizes.
+func (sc *StatisticsCollector) AnalyzeSymlink(path string, info types.FileInfo) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.symlinks.Links++
+	sc.symlinks.Bytes += info.Size
+
+	return nil
+}
+
+func (sc *StatisticsCollector) AddBrokenLink(link types.BrokenLink) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.brokenLinks = append(sc.brokenLinks, link)
+}
+
+// AddArchive records what was found inside an archive file. The archive
+// itself is counted by AnalyzeFile like any other file.
+func (sc *StatisticsCollector) AddArchive(stats types.ArchiveStats) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.archives = append(sc.archives, stats)
+}
+
+func (sc *StatisticsCollector) rootStat(path string) *types.RootStats {
+	for i := range sc.rootStats {
+		if sc.rootStats[i].Path == path && sc.rootStats[i].CoveredBy == "" {
+			return &sc.rootStats[i]
+		}
+	}
+	return &types.RootStats{}
+}
+
+func (sc *StatisticsCollector) directoryStat(path string) *types.DirectoryStats {
+	stat, exists := sc.directoryStats[path]
+	if !exists {
+		stat = &types.DirectoryStats{Path: path}
+		sc.directoryStats[path] = stat
+	}
+	return stat
+}
+
+func (sc *StatisticsCollector) AddSkippedMount(path string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.skippedMounts = append(sc.skippedMounts, path)
+}
+
+func (sc *StatisticsCollector) AddSkipped(skipped types.SkippedPath) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.skipped = append(sc.skipped, skipped)
+}
+
+// AddIgnored records an entry left out by an ignore file. size is only
+// counted for files.
+func (sc *StatisticsCollector) AddIgnored(isDir bool, size int64) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if isDir {
+		sc.ignored.Dirs++
+	} else {
+		sc.ignored.Files++
+		sc.ignored.Bytes += size
+	}
+}
+
 func (sc *StatisticsCollector) IncrementError() {
 	sc.mu.Lock()
 	defer sc.mu.Unlock()
@@ -150,25 +366,70 @@ func (sc *StatisticsCollector) GetResults() *types.ScanResult {
 		bytesPerSecond = float64(sc.totalSize) / scanDuration.Seconds()
 	}
 
-	topExtensions := sc.getTopExtensions(5)
-	topDirectories := sc.getTopDirectories(5)
+	skippedMounts := append([]string(nil), sc.skippedMounts...)
+	sort.Strings(skippedMounts)
+
+	skipped := append([]types.SkippedPath(nil), sc.skipped...)
+	sort.Slice(skipped, func(i, j int) bool {
+		return skipped[i].Path < skipped[j].Path
+	})
+
+	brokenLinks := append([]types.BrokenLink(nil), sc.brokenLinks...)
+	sort.Slice(brokenLinks, func(i, j int) bool {
+		return brokenLinks[i].Path < brokenLinks[j].Path
+	})
+
+	archives := append([]types.ArchiveStats(nil), sc.archives...)
+	sort.Slice(archives, func(i, j int) bool {
+		if archives[i].UncompressedSize != archives[j].UncompressedSize {
+			return archives[i].UncompressedSize > archives[j].UncompressedSize
+		}
+		return archives[i].Path < archives[j].Path
+	})
+
+	topExtensions := sc.getTopExtensions(sc.topN)
+	extensions := sc.getTopExtensions(len(sc.extensionStats))
+	topDirectories := sc.getTopDirectories(sc.topN)
+
+	// getTopDirectories has rolled up the recursive totals by now.
+	roots := append([]types.RootStats(nil), sc.rootStats...)
+	for i, root := range roots {
+		if stat, ok := sc.directoryStats[root.Path]; ok && root.CoveredBy == "" {
+			roots[i].Files = stat.RecursiveFileCount
+			roots[i].Dirs = stat.RecursiveDirCount + 1
+			roots[i].Size = stat.RecursiveSize
+			roots[i].DiskUsage = stat.RecursiveDiskUsage
+		}
+	}
 
 	return &types.ScanResult{
 		TotalFiles:      sc.totalFiles,
 		TotalDirs:       sc.totalDirs,
 		TotalSize:       sc.totalSize,
+		TotalDiskUsage:  sc.totalDisk,
 		TotalErrors:     sc.totalErrors,
 		ScanDuration:    scanDuration,
+		SizeMode:        sc.sizeMode,
 		LargestFile:     sc.largestFile,
 		SmallestFile:    sc.smallestFile,
 		OldestFile:      sc.oldestFile,
 		NewestFile:      sc.newestFile,
 		AverageFileSize: avgFileSize,
+		HardLinks:       sc.hardLinks,
+		SkippedMounts:   skippedMounts,
+		Ignored:         sc.ignored,
+		Skipped:         skipped,
+		Symlinks:        sc.symlinks,
+		BrokenLinks:     brokenLinks,
+		Archives:        archives,
 		TopExtensions:   topExtensions,
+		Extensions:      extensions,
 		TopDirectories:  topDirectories,
+		Roots:           roots,
 		FilesPerSecond:  filesPerSecond,
 		BytesPerSecond:  bytesPerSecond,
 		DepthStats:      sc.depthStats,
+		MaxDepth:        sc.maxDepth,
 	}
 }
 
@@ -179,11 +440,23 @@ func (sc *StatisticsCollector) Reset() {
 	sc.totalFiles = 0
 	sc.totalDirs = 0
 	sc.totalSize = 0
+	sc.totalDisk = 0
 	sc.totalErrors = 0
 	sc.startTime = time.Now()
 	sc.extensionStats = make(map[string]*types.ExtensionStats)
 	sc.directoryStats = make(map[string]*types.DirectoryStats)
+	sc.collapsed = make(map[string]*types.DirectoryStats)
 	sc.depthStats = make(map[int]int64)
+	sc.hardLinks = types.HardLinkStats{}
+	sc.seenLinks = make(map[types.FileID]struct{})
+	sc.skippedMounts = nil
+	sc.ignored = types.IgnoreStats{}
+	sc.skipped = nil
+	sc.symlinks = types.SymlinkStats{}
+	sc.brokenLinks = nil
+	sc.archives = nil
+	sc.roots = make(map[string]bool)
+	sc.rootStats = nil
 }
 
 func (sc *StatisticsCollector) getTopExtensions(n int) []types.ExtensionStats {
@@ -202,7 +475,10 @@ func (sc *StatisticsCollector) getTopExtensions(n int) []types.ExtensionStats {
 	}
 
 	sort.Slice(extensions, func(i, j int) bool {
-		return extensions[i].Count > extensions[j].Count
+		if extensions[i].Count != extensions[j].Count {
+			return extensions[i].Count > extensions[j].Count
+		}
+		return extensions[i].Extension < extensions[j].Extension
 	})
 
 	if len(extensions) > n {
@@ -215,6 +491,7 @@ func (sc *StatisticsCollector) getTopExtensions(n int) []types.ExtensionStats {
 func (sc *StatisticsCollector) getTopDirectories(n int) []types.DirectoryStats {
 	var directories []types.DirectoryStats
 
+	sc.rollUpDirectories()
 	for _, stat := range sc.directoryStats {
 		if stat.FileCount > 0 {
 			stat.AverageSize = float64(stat.TotalSize) / float64(stat.FileCount)
@@ -222,8 +499,17 @@ func (sc *StatisticsCollector) getTopDirectories(n int) []types.DirectoryStats {
 		directories = append(directories, *stat)
 	}
 
+	size := func(d types.DirectoryStats) int64 {
+		if sc.dirSort == types.DirSortRecursive {
+			return d.RecursiveSizeFor(sc.sizeMode)
+		}
+		return d.SizeFor(sc.sizeMode)
+	}
 	sort.Slice(directories, func(i, j int) bool {
-		return directories[i].TotalSize > directories[j].TotalSize
+		if size(directories[i]) != size(directories[j]) {
+			return size(directories[i]) > size(directories[j])
+		}
+		return directories[i].Path < directories[j].Path
 	})
 
 	if len(directories) > n {
@@ -233,6 +519,49 @@ func (sc *StatisticsCollector) getTopDirectories(n int) []types.DirectoryStats {
 	return directories
 }
 
+// rollUpDirectories recomputes the recursive totals of every directory by
+// folding each directory into its parent, deepest first. Directories at the
+// depth cutoff start from the totals collapsed below them.
+func (sc *StatisticsCollector) rollUpDirectories() {
+	paths := make([]string, 0, len(sc.directoryStats))
+	for path, stat := range sc.directoryStats {
+		stat.RecursiveFileCount = stat.FileCount
+		stat.RecursiveDirCount = stat.DirCount
+		stat.RecursiveSize = stat.TotalSize
+		stat.RecursiveDiskUsage = stat.DiskUsage
+		if below, ok := sc.collapsed[path]; ok {
+			stat.RecursiveFileCount += below.FileCount
+			stat.RecursiveDirCount += below.DirCount
+			stat.RecursiveSize += below.TotalSize
+			stat.RecursiveDiskUsage += below.DiskUsage
+		}
+		paths = append(paths, path)
+	}
+
+	sort.Slice(paths, func(i, j int) bool {
+		return pathDepth(paths[i]) > pathDepth(paths[j])
+	})
+
+	for _, path := range paths {
+		if sc.roots[path] {
+			continue
+		}
+		parent, exists := sc.directoryStats[filepath.Dir(path)]
+		if !exists || parent.Path == path {
+			continue
+		}
+		stat := sc.directoryStats[path]
+		parent.RecursiveFileCount += stat.RecursiveFileCount
+		parent.RecursiveDirCount += stat.RecursiveDirCount
+		parent.RecursiveSize += stat.RecursiveSize
+		parent.RecursiveDiskUsage += stat.RecursiveDiskUsage
+	}
+}
+
+func pathDepth(path string) int {
+	return strings.Count(path, string(filepath.Separator))
+}
+
 func GetExtensionCategory(ext string) string {
 	if category, exists := types.ExtensionCategories[strings.ToLower(ext)]; exists {
 		return category
@@ -0,0 +1,182 @@
+// Package archive lists the members of tar and zip archives without
+// extracting them.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ulikunitz/xz"
+)
+
+// Archive formats, as returned by Format.
+const (
+	FormatTar   = "tar"
+	FormatTarGz = "tar.gz"
+	FormatTarXz = "tar.xz"
+	FormatZip   = "zip"
+)
+
+// Member is one entry of an archive. Name is the slash-separated path
+// inside the archive. CompressedSize is only known per member for zip
+// files; for tar files it is the same as Size, and for compressed tar
+// files it is -1, since the stream is compressed as a whole. The owner
+// fields are only set for tar members; zip files don't record owners.
+type Member struct {
+	Name           string
+	Size           int64
+	CompressedSize int64
+	ModTime        time.Time
+	Mode           fs.FileMode
+	IsDir          bool
+	Uid            int
+	Gid            int
+	Uname          string
+	Gname          string
+}
+
+// Format returns the archive format of a file going by its name, or "" if
+// it isn't one that can be listed.
+func Format(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".tar"):
+		return FormatTar
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return FormatTarGz
+	case strings.HasSuffix(name, ".tar.xz"), strings.HasSuffix(name, ".txz"):
+		return FormatTarXz
+	case strings.HasSuffix(name, ".zip"):
+		return FormatZip
+	}
+	return ""
+}
+
+// WalkFS calls fn for every member of the archive at name in fsys, in
+// archive order. It stops at the first error returned by fn or met while
+// reading.
+func WalkFS(fsys fs.FS, name string, fn func(Member) error) error {
+	if Format(name) == "" {
+		return errors.New("not a supported archive")
+	}
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return walkFile(f, Format(name), fn)
+}
+
+func walkFile(f fs.File, format string, fn func(Member) error) error {
+	switch format {
+	case FormatZip:
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		// Zip keeps its index at the end, so it needs random access.
+		// Files that can't provide it are read into memory.
+		r, ok := f.(io.ReaderAt)
+		if !ok {
+			data, err := io.ReadAll(f)
+			if err != nil {
+				return err
+			}
+			r = bytes.NewReader(data)
+		}
+		return walkZip(r, info.Size(), fn)
+	case FormatTarGz:
+		r, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		return walkTar(r, -1, fn)
+	case FormatTarXz:
+		r, err := xz.NewReader(f)
+		if err != nil {
+			return err
+		}
+		return walkTar(r, -1, fn)
+	default:
+		return walkTar(f, 0, fn)
+	}
+}
+
+// walkTar lists a tar stream. compressed is -1 when the stream was
+// decompressed, so member sizes on disk are unknown.
+func walkTar(r io.Reader, compressed int64, fn func(Member) error) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		info := hdr.FileInfo()
+		m := Member{
+			Name:           cleanName(hdr.Name),
+			Size:           hdr.Size,
+			CompressedSize: compressed,
+			ModTime:        hdr.ModTime,
+			Mode:           info.Mode(),
+			IsDir:          info.IsDir(),
+			Uid:            hdr.Uid,
+			Gid:            hdr.Gid,
+			Uname:          hdr.Uname,
+			Gname:          hdr.Gname,
+		}
+		if compressed >= 0 {
+			m.CompressedSize = hdr.Size
+		}
+		if m.Name == "" {
+			continue
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+}
+
+func walkZip(r io.ReaderAt, size int64, fn func(Member) error) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, file := range zr.File {
+		info := file.FileInfo()
+		m := Member{
+			Name:           cleanName(file.Name),
+			Size:           int64(file.UncompressedSize64),
+			CompressedSize: int64(file.CompressedSize64),
+			ModTime:        file.Modified,
+			Mode:           info.Mode(),
+			IsDir:          info.IsDir(),
+		}
+		if m.Name == "" {
+			continue
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanName turns a member name into a relative slash-separated path, so
+// names such as "./bin/" or "/etc/passwd" can't point outside the archive.
+func cleanName(name string) string {
+	name = path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	return strings.TrimPrefix(name, "/")
+}
@@ -0,0 +1,281 @@
+// Package diff compares two scans of a tree, such as a saved snapshot and
+// the tree as it is now, and reports which files appeared, vanished or
+// changed and how the size of each directory and extension moved.
+package diff
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"file-counter/pkg/scanner/types"
+)
+
+// Tree is one side of a comparison: the roots a scan started from and the
+// entries it recorded. Only files are compared; directories come from the
+// files' paths, and links, like in the scan totals, don't count.
+type Tree struct {
+	Roots   []string
+	Entries []types.FileInfo
+}
+
+// FileChange is a file that was added, removed or modified. Sizes are the
+// ones the file adds to its scan's total, so extra hard links to an inode
+// already counted are 0.
+type FileChange struct {
+	Path    string
+	OldSize int64
+	NewSize int64
+}
+
+func (c FileChange) Delta() int64 {
+	return c.NewSize - c.OldSize
+}
+
+// DirectoryChange is the change in the size and file count of a whole
+// subtree.
+type DirectoryChange struct {
+	Path     string
+	OldFiles int64
+	NewFiles int64
+	OldSize  int64
+	NewSize  int64
+}
+
+func (c DirectoryChange) Delta() int64 {
+	return c.NewSize - c.OldSize
+}
+
+type ExtensionChange struct {
+	Extension string
+	OldCount  int64
+	NewCount  int64
+	OldSize   int64
+	NewSize   int64
+}
+
+func (c ExtensionChange) Delta() int64 {
+	return c.NewSize - c.OldSize
+}
+
+// Result is the outcome of Compare. Every list is sorted by the size of the
+// change, largest first, whether it grew or shrank.
+type Result struct {
+	// SizeMode is the size (types.SizeApparent or types.SizeDisk) that
+	// was compared.
+	SizeMode string
+
+	// Relative is set when both trees had a single root, in which case
+	// paths are relative to it and the two roots may differ.
+	Relative bool
+
+	OldFiles int64
+	NewFiles int64
+	OldSize  int64
+	NewSize  int64
+
+	Added       []FileChange
+	Removed     []FileChange
+	Modified    []FileChange
+	Directories []DirectoryChange
+	Extensions  []ExtensionChange
+}
+
+func (r *Result) Delta() int64 {
+	return r.NewSize - r.OldSize
+}
+
+// file is what Compare keeps of an entry.
+type file struct {
+	info types.FileInfo
+	size int64
+}
+
+type side struct {
+	files map[string]file
+	roots []string
+}
+
+// Compare compares two trees by their sizes in mode. A file present in both
+// is modified if its size, modification time, type or, when both scans
+// hashed it, digest differs.
+func Compare(older, newer Tree, mode string) *Result {
+	relative := len(older.Roots) == 1 && len(newer.Roots) == 1
+	before := index(older, relative, mode)
+	after := index(newer, relative, mode)
+
+	// Directories roll up to the roots of either tree, so a tree made
+	// from a path list lines up with a scan of the directory holding them.
+	stop := make(map[string]bool)
+	for _, root := range append(before.roots, after.roots...) {
+		stop[root] = true
+	}
+
+	result := &Result{SizeMode: mode, Relative: relative}
+	dirs := make(map[string]*DirectoryChange)
+	exts := make(map[string]*ExtensionChange)
+
+	for path, f := range before.files {
+		result.OldFiles++
+		result.OldSize += f.size
+		for _, dir := range ancestors(path, stop) {
+			d := dirChange(dirs, dir)
+			d.OldFiles++
+			d.OldSize += f.size
+		}
+		e := extChange(exts, f.info.Extension)
+		e.OldCount++
+		e.OldSize += f.size
+
+		g, ok := after.files[path]
+		switch {
+		case !ok:
+			result.Removed = append(result.Removed, FileChange{Path: path, OldSize: f.size})
+		case modified(f.info, g.info):
+			result.Modified = append(result.Modified, FileChange{Path: path, OldSize: f.size, NewSize: g.size})
+		}
+	}
+
+	for path, f := range after.files {
+		result.NewFiles++
+		result.NewSize += f.size
+		for _, dir := range ancestors(path, stop) {
+			d := dirChange(dirs, dir)
+			d.NewFiles++
+			d.NewSize += f.size
+		}
+		e := extChange(exts, f.info.Extension)
+		e.NewCount++
+		e.NewSize += f.size
+
+		if _, ok := before.files[path]; !ok {
+			result.Added = append(result.Added, FileChange{Path: path, NewSize: f.size})
+		}
+	}
+
+	for _, d := range dirs {
+		if d.Delta() != 0 || d.OldFiles != d.NewFiles {
+			result.Directories = append(result.Directories, *d)
+		}
+	}
+	for _, e := range exts {
+		if e.Delta() != 0 || e.OldCount != e.NewCount {
+			result.Extensions = append(result.Extensions, *e)
+		}
+	}
+
+	sortChanges(result.Added, func(c FileChange) (int64, string) { return c.Delta(), c.Path })
+	sortChanges(result.Removed, func(c FileChange) (int64, string) { return c.Delta(), c.Path })
+	sortChanges(result.Modified, func(c FileChange) (int64, string) { return c.Delta(), c.Path })
+	sortChanges(result.Directories, func(c DirectoryChange) (int64, string) { return c.Delta(), c.Path })
+	sortChanges(result.Extensions, func(c ExtensionChange) (int64, string) { return c.Delta(), c.Extension })
+	return result
+}
+
+// index indexes the files of a tree by path, relative to its root if
+// relative is set. Of several hard links to one inode only the first path
+// in sorted order carries the bytes, so the choice doesn't depend on the
+// order the scan happened to find them in.
+func index(t Tree, relative bool, mode string) *side {
+	s := &side{files: make(map[string]file)}
+	for _, root := range t.Roots {
+		s.roots = append(s.roots, keyOf(root, t.Roots, relative))
+	}
+
+	owners := make(map[types.FileID]string)
+	for _, info := range t.Entries {
+		if info.IsDir || info.IsSymlink() || info.Archive != "" {
+			continue
+		}
+		path := keyOf(info.Path, t.Roots, relative)
+		s.files[path] = file{info: info, size: info.SizeFor(mode)}
+		if info.Links > 1 {
+			if owner, ok := owners[info.ID()]; !ok || path < owner {
+				owners[info.ID()] = path
+			}
+		}
+	}
+
+	for path, f := range s.files {
+		if f.info.Links > 1 && owners[f.info.ID()] != path {
+			f.size = 0
+			s.files[path] = f
+		}
+	}
+	return s
+}
+
+// keyOf is the path files are matched by in the two trees.
+func keyOf(path string, roots []string, relative bool) string {
+	if relative {
+		if rel, err := filepath.Rel(roots[0], path); err == nil {
+			return rel
+		}
+	}
+	return path
+}
+
+// ancestors returns the directories above path up to the first one in stop,
+// or the top of the filesystem for paths outside them.
+func ancestors(path string, stop map[string]bool) []string {
+	var dirs []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if stop[dir] || dir == "." || dir == filepath.Dir(dir) {
+			return dirs
+		}
+	}
+}
+
+func modified(a, b types.FileInfo) bool {
+	switch {
+	case a.Size != b.Size, a.Mode.Type() != b.Mode.Type():
+		return true
+	case !a.ModTime.Equal(b.ModTime):
+		return true
+	case a.Digest != "" && b.Digest != "" && !strings.EqualFold(a.Digest, b.Digest):
+		return true
+	}
+	return false
+}
+
+func dirChange(dirs map[string]*DirectoryChange, path string) *DirectoryChange {
+	d, ok := dirs[path]
+	if !ok {
+		d = &DirectoryChange{Path: path}
+		dirs[path] = d
+	}
+	return d
+}
+
+func extChange(exts map[string]*ExtensionChange, ext string) *ExtensionChange {
+	if ext == "" {
+		ext = "[no extension]"
+	}
+	e, ok := exts[ext]
+	if !ok {
+		e = &ExtensionChange{Extension: ext}
+		exts[ext] = e
+	}
+	return e
+}
+
+// sortChanges orders changes by the absolute size of their delta, largest
+// first, then by name.
+func sortChanges[T any](changes []T, key func(T) (int64, string)) {
+	sort.Slice(changes, func(i, j int) bool {
+		di, ni := key(changes[i])
+		dj, nj := key(changes[j])
+		if abs(di) != abs(dj) {
+			return abs(di) > abs(dj)
+		}
+		return ni < nj
+	})
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,276 @@
+package diff
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"file-counter/pkg/scanner"
+	"file-counter/pkg/scanner/snapshot"
+	"file-counter/pkg/scanner/types"
+)
+
+var t0 = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// regular is a regular file of size bytes.
+func regular(path string, size int64) types.FileInfo {
+	return types.FileInfo{Path: path, Size: size, DiskUsage: (size + 4095) / 4096 * 4096, ModTime: t0, Mode: 0o644, Extension: types.ExtensionOf(filepath.Base(path)), Links: 1}
+}
+
+func TestCompareRelative(t *testing.T) {
+	older := Tree{Roots: []string{"/old"}, Entries: []types.FileInfo{
+		{Path: "/old", IsDir: true, Mode: fs.ModeDir | 0o755},
+		regular("/old/same.txt", 100),
+		regular("/old/grew.log", 1000),
+		regular("/old/gone.bin", 5000),
+		regular("/old/src/touched.go", 50),
+		regular("/old/src/hashed.go", 60),
+	}}
+	older.Entries[5].Digest = "aaaa"
+
+	newer := Tree{Roots: []string{"/new"}, Entries: []types.FileInfo{
+		{Path: "/new", IsDir: true, Mode: fs.ModeDir | 0o755},
+		regular("/new/same.txt", 100),
+		regular("/new/grew.log", 3000),
+		regular("/new/src/touched.go", 50),
+		regular("/new/src/hashed.go", 60),
+		regular("/new/src/added.go", 700),
+		{Path: "/new/src/link", Mode: fs.ModeSymlink | 0o777, Size: 9999},
+		{Path: "/new/a.zip/member.txt", Size: 9999, Archive: "/new/a.zip"},
+	}}
+	newer.Entries[3].ModTime = t0.Add(time.Minute)
+	newer.Entries[4].Digest = "AAAB"
+
+	result := Compare(older, newer, types.SizeApparent)
+
+	if !result.Relative {
+		t.Errorf("Relative = false, want true for single roots")
+	}
+	if result.OldFiles != 5 || result.NewFiles != 5 {
+		t.Errorf("files = %d -> %d, want 5 -> 5", result.OldFiles, result.NewFiles)
+	}
+	if result.OldSize != 6210 || result.NewSize != 3910 || result.Delta() != -2300 {
+		t.Errorf("size = %d -> %d, want 6210 -> 3910", result.OldSize, result.NewSize)
+	}
+
+	wantAdded := []FileChange{{Path: "src/added.go", NewSize: 700}}
+	wantRemoved := []FileChange{{Path: "gone.bin", OldSize: 5000}}
+	// Sorted by the size of the change, then by path.
+	wantModified := []FileChange{
+		{Path: "grew.log", OldSize: 1000, NewSize: 3000},
+		{Path: "src/hashed.go", OldSize: 60, NewSize: 60},
+		{Path: "src/touched.go", OldSize: 50, NewSize: 50},
+	}
+	if !reflect.DeepEqual(result.Added, wantAdded) {
+		t.Errorf("Added = %+v, want %+v", result.Added, wantAdded)
+	}
+	if !reflect.DeepEqual(result.Removed, wantRemoved) {
+		t.Errorf("Removed = %+v, want %+v", result.Removed, wantRemoved)
+	}
+	if !reflect.DeepEqual(result.Modified, wantModified) {
+		t.Errorf("Modified = %+v, want %+v", result.Modified, wantModified)
+	}
+
+	// Directories roll up to the root, which is "." in relative mode.
+	wantDirs := []DirectoryChange{
+		{Path: ".", OldFiles: 5, NewFiles: 5, OldSize: 6210, NewSize: 3910},
+		{Path: "src", OldFiles: 2, NewFiles: 3, OldSize: 110, NewSize: 810},
+	}
+	if !reflect.DeepEqual(result.Directories, wantDirs) {
+		t.Errorf("Directories = %+v, want %+v", result.Directories, wantDirs)
+	}
+
+	wantExts := []ExtensionChange{
+		{Extension: ".bin", OldCount: 1, NewCount: 0, OldSize: 5000, NewSize: 0},
+		{Extension: ".log", OldCount: 1, NewCount: 1, OldSize: 1000, NewSize: 3000},
+		{Extension: ".go", OldCount: 2, NewCount: 3, OldSize: 110, NewSize: 810},
+	}
+	if !reflect.DeepEqual(result.Extensions, wantExts) {
+		t.Errorf("Extensions = %+v, want %+v", result.Extensions, wantExts)
+	}
+}
+
+func TestCompareDiskMode(t *testing.T) {
+	older := Tree{Roots: []string{"/r"}, Entries: []types.FileInfo{regular("/r/a", 10)}}
+	newer := Tree{Roots: []string{"/r"}, Entries: []types.FileInfo{regular("/r/a", 5000)}}
+
+	result := Compare(older, newer, types.SizeDisk)
+	want := []FileChange{{Path: "a", OldSize: 4096, NewSize: 8192}}
+	if !reflect.DeepEqual(result.Modified, want) {
+		t.Errorf("Modified = %+v, want %+v", result.Modified, want)
+	}
+}
+
+func TestCompareHardLinks(t *testing.T) {
+	link := func(path string) types.FileInfo {
+		info := regular(path, 400)
+		info.Links, info.Device, info.Inode = 2, 1, 77
+		return info
+	}
+
+	// Whichever order the scan found them in, the first path in sorted
+	// order carries the bytes.
+	older := Tree{Roots: []string{"/r"}, Entries: []types.FileInfo{link("/r/b"), link("/r/a")}}
+	newer := Tree{Roots: []string{"/r"}, Entries: []types.FileInfo{link("/r/a"), regular("/r/b", 400)}}
+	newer.Entries[0].Links = 1
+
+	result := Compare(older, newer, types.SizeApparent)
+	if result.OldSize != 400 || result.NewSize != 800 {
+		t.Errorf("size = %d -> %d, want 400 -> 800", result.OldSize, result.NewSize)
+	}
+	// b no longer shares a's storage, but the file itself didn't change.
+	if len(result.Modified) != 0 {
+		t.Errorf("Modified = %+v, want none", result.Modified)
+	}
+	want := []DirectoryChange{{Path: ".", OldFiles: 2, NewFiles: 2, OldSize: 400, NewSize: 800}}
+	if !reflect.DeepEqual(result.Directories, want) {
+		t.Errorf("Directories = %+v, want %+v", result.Directories, want)
+	}
+}
+
+func TestCompareSeveralRoots(t *testing.T) {
+	older := Tree{Roots: []string{"/x"}, Entries: []types.FileInfo{
+		regular("/x/p/a.txt", 10),
+		regular("/x/q/b.txt", 20),
+	}}
+	// A tree made from a list of paths has no roots.
+	newer := Tree{Entries: []types.FileInfo{
+		regular("/x/p/a.txt", 10),
+		regular("/x/q/b.txt", 25),
+		regular("/y/c.txt", 5),
+	}}
+
+	result := Compare(older, newer, types.SizeApparent)
+	if result.Relative {
+		t.Errorf("Relative = true, want false")
+	}
+	if want := []FileChange{{Path: "/y/c.txt", NewSize: 5}}; !reflect.DeepEqual(result.Added, want) {
+		t.Errorf("Added = %+v, want %+v", result.Added, want)
+	}
+
+	// Paths under /x stop at it; the others go up to the top.
+	got := make(map[string]int64)
+	for _, d := range result.Directories {
+		got[d.Path] = d.Delta()
+	}
+	want := map[string]int64{"/x": 5, "/x/q": 5, "/y": 5, "/": 5}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("directory deltas = %v, want %v", got, want)
+	}
+}
+
+func TestCompareUnchanged(t *testing.T) {
+	tree := Tree{Roots: []string{"/r"}, Entries: []types.FileInfo{regular("/r/a.txt", 10), regular("/r/d/b.txt", 20)}}
+	result := Compare(tree, tree, types.SizeApparent)
+	if len(result.Added)+len(result.Removed)+len(result.Modified)+len(result.Directories)+len(result.Extensions) != 0 {
+		t.Errorf("comparing a tree with itself found changes: %+v", result)
+	}
+}
+
+// scanTree scans roots the way fs diff scans the live side, passing every
+// entry to visit.
+func scanTree(t *testing.T, roots []string, visit func(types.FileInfo)) *types.ScanResult {
+	t.Helper()
+	s := scanner.NewScanner(
+		scanner.WithQuiet(true),
+		scanner.WithProgressWriter(io.Discard),
+		scanner.WithoutDefaultExcludes(),
+		scanner.WithVisitor(visit),
+	)
+	defer s.Stop()
+	return s.Start(roots...)
+}
+
+func TestCompareSnapshotWithLiveScan(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{"a/x.txt": "abc", "a/sub/z.go": "package z", "b/y.txt": "yo"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The snapshot is saved from relative roots, as "fs -save s.fss a b"
+	// run in dir would.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	var buf bytes.Buffer
+	sw, err := snapshot.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	result := scanTree(t, []string{"a", "b"}, func(info types.FileInfo) {
+		mu.Lock()
+		sw.Add(info)
+		mu.Unlock()
+	})
+	if err := sw.Close(result, scanner.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := snapshot.Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	older := Tree{Roots: snap.Roots(), Entries: snap.Entries}
+
+	// The live side is given the same relative paths, which fs diff
+	// makes absolute before scanning.
+	var live []string
+	for _, root := range []string{"a", "b"} {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		live = append(live, abs)
+	}
+	var entries []types.FileInfo
+	scanTree(t, live, func(info types.FileInfo) {
+		mu.Lock()
+		entries = append(entries, info)
+		mu.Unlock()
+	})
+	newer := Tree{Roots: live, Entries: entries}
+
+	unchanged := Compare(older, newer, types.SizeApparent)
+	if unchanged.Relative {
+		t.Errorf("Relative = true, want false for two roots")
+	}
+	if unchanged.OldFiles != 3 || unchanged.NewFiles != 3 {
+		t.Errorf("files = %d -> %d, want 3 -> 3", unchanged.OldFiles, unchanged.NewFiles)
+	}
+	if n := len(unchanged.Added) + len(unchanged.Removed) + len(unchanged.Modified) + len(unchanged.Directories); n != 0 {
+		t.Errorf("unchanged tree shows changes: %+v", unchanged)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "b", "new.txt"), []byte("12345"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	entries = nil
+	scanTree(t, snap.Roots(), func(info types.FileInfo) {
+		mu.Lock()
+		entries = append(entries, info)
+		mu.Unlock()
+	})
+	grown := Compare(older, Tree{Roots: snap.Roots(), Entries: entries}, types.SizeApparent)
+	want := []FileChange{{Path: filepath.Join(dir, "b", "new.txt"), NewSize: 5}}
+	if !reflect.DeepEqual(grown.Added, want) || len(grown.Removed) != 0 {
+		t.Errorf("Added, Removed = %+v, %+v, want %+v and none", grown.Added, grown.Removed, want)
+	}
+}
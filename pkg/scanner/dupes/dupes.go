@@ -0,0 +1,230 @@
+// Package dupes finds files with identical contents among the files of a
+// scan. Candidates are narrowed in stages so that most files are never
+// read: first by size, then by a hash of their first and last few
+// kilobytes, and only then by a SHA-256 of their whole contents.
+package dupes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"runtime"
+	"sort"
+	"sync"
+
+	"file-counter/pkg/scanner/types"
+)
+
+// edgeSize is how much of each end of a file goes into the partial hash.
+const edgeSize = 4 * 1024
+
+type candidate struct {
+	path string
+	size int64
+	hash string
+}
+
+// Finder collects files and groups the ones with the same contents.
+type Finder struct {
+	fsys    fs.FS
+	minSize int64
+	workers int
+
+	mu     sync.Mutex
+	bySize map[int64][]candidate
+	inodes map[types.FileID]bool
+	links  int64
+	errors int64
+}
+
+// NewFinder returns a Finder that reads file contents from fsys, using the
+// paths the scan reported. Files smaller than minSize are ignored; empty
+// files always are.
+func NewFinder(fsys fs.FS, minSize int64) *Finder {
+	if minSize < 1 {
+		minSize = 1
+	}
+	return &Finder{
+		fsys:    fsys,
+		minSize: minSize,
+		workers: runtime.GOMAXPROCS(0),
+		bySize:  make(map[int64][]candidate),
+		inodes:  make(map[types.FileID]bool),
+	}
+}
+
+// Add records a file as a candidate. Directories, links, special files and
+// archive members are ignored, and of several paths to one inode only the
+// first is kept, since they share their storage.
+func (f *Finder) Add(info types.FileInfo) {
+	if !info.Mode.IsRegular() || info.Archive != "" || info.Size < f.minSize {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// A file can also be reached twice without a second hard link, by
+	// following a symbolic link or through a bind mount. Filesystems other
+	// than the OS's have no inode numbers to go by.
+	if info.Inode != 0 {
+		if f.inodes[info.ID()] {
+			f.links++
+			return
+		}
+		f.inodes[info.ID()] = true
+	}
+	f.bySize[info.Size] = append(f.bySize[info.Size], candidate{path: info.Path, size: info.Size})
+}
+
+// Find reads the candidates and returns the duplicate sets, the ones
+// wasting the most space first.
+func (f *Finder) Find() types.DuplicateStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var groups [][]candidate
+	for _, group := range f.bySize {
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+	}
+
+	// Files no larger than both edges together are read whole by the
+	// partial hash, which makes it a full hash.
+	groups = f.refine(groups, partialHash)
+	var small, large [][]candidate
+	for _, group := range groups {
+		if group[0].size <= 2*edgeSize {
+			small = append(small, group)
+		} else {
+			large = append(large, group)
+		}
+	}
+	groups = append(small, f.refine(large, fullHash)...)
+
+	stats := types.DuplicateStats{HardLinksSkipped: f.links}
+	for _, group := range groups {
+		set := types.DuplicateSet{
+			Size:        group[0].size,
+			SHA256:      group[0].hash,
+			WastedBytes: group[0].size * int64(len(group)-1),
+		}
+		for _, c := range group {
+			set.Paths = append(set.Paths, c.path)
+		}
+		sort.Strings(set.Paths)
+		stats.Sets = append(stats.Sets, set)
+		stats.Files += int64(len(group))
+		stats.WastedBytes += set.WastedBytes
+	}
+	sort.Slice(stats.Sets, func(i, j int) bool {
+		if stats.Sets[i].WastedBytes != stats.Sets[j].WastedBytes {
+			return stats.Sets[i].WastedBytes > stats.Sets[j].WastedBytes
+		}
+		return stats.Sets[i].Paths[0] < stats.Sets[j].Paths[0]
+	})
+	stats.Errors = f.errors
+	return stats
+}
+
+// refine hashes every candidate in groups with hash and splits each group
+// by the result, dropping the files left without a match.
+func (f *Finder) refine(groups [][]candidate, hash func(io.ReadSeeker, int64) (string, error)) [][]candidate {
+	jobs := make(chan *candidate)
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+	for i := 0; i < f.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range jobs {
+				sum, err := f.hashFile(c.path, c.size, hash)
+				if err != nil {
+					errMu.Lock()
+					f.errors++
+					errMu.Unlock()
+				}
+				c.hash = sum
+			}
+		}()
+	}
+	for _, group := range groups {
+		for i := range group {
+			jobs <- &group[i]
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	var refined [][]candidate
+	for _, group := range groups {
+		byHash := make(map[string][]candidate)
+		var order []string
+		for _, c := range group {
+			if c.hash == "" {
+				continue
+			}
+			if _, ok := byHash[c.hash]; !ok {
+				order = append(order, c.hash)
+			}
+			byHash[c.hash] = append(byHash[c.hash], c)
+		}
+		for _, sum := range order {
+			if len(byHash[sum]) > 1 {
+				refined = append(refined, byHash[sum])
+			}
+		}
+	}
+	return refined
+}
+
+func (f *Finder) hashFile(path string, size int64, hash func(io.ReadSeeker, int64) (string, error)) (string, error) {
+	file, err := f.fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	r, ok := file.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return "", err
+		}
+		r = bytes.NewReader(data)
+	}
+	return hash(r, size)
+}
+
+// partialHash hashes the first and last edgeSize bytes of a file, or all
+// of it if it is smaller than that.
+func partialHash(r io.ReadSeeker, size int64) (string, error) {
+	h := sha256.New()
+	if size <= 2*edgeSize {
+		if _, err := io.Copy(h, r); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	if _, err := io.CopyN(h, r, edgeSize); err != nil {
+		return "", err
+	}
+	if _, err := r.Seek(-edgeSize, io.SeekEnd); err != nil {
+		return "", err
+	}
+	if _, err := io.CopyN(h, r, edgeSize); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func fullHash(r io.ReadSeeker, size int64) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
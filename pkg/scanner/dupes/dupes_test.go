@@ -0,0 +1,204 @@
+package dupes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"file-counter/pkg/scanner/types"
+)
+
+// countingFS counts how often each file is opened.
+type countingFS struct {
+	fstest.MapFS
+	mu    sync.Mutex
+	opens map[string]int
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	c.mu.Lock()
+	c.opens[name]++
+	c.mu.Unlock()
+	return c.MapFS.Open(name)
+}
+
+// newFinder returns a Finder over files, with every file added in path
+// order, and the FS it reads them through.
+func newFinder(files fstest.MapFS, minSize int64) (*Finder, *countingFS) {
+	fsys := &countingFS{MapFS: files, opens: make(map[string]int)}
+	f := NewFinder(fsys, minSize)
+	for _, path := range sortedPaths(files) {
+		f.Add(regular(path, int64(len(files[path].Data))))
+	}
+	return f, fsys
+}
+
+func sortedPaths(files fstest.MapFS) []string {
+	paths, _ := fs.Glob(files, "*")
+	return paths
+}
+
+func regular(path string, size int64) types.FileInfo {
+	return types.FileInfo{Path: path, Size: size, Mode: 0o644}
+}
+
+func sum(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// big returns a file larger than both partial hash edges together, made of
+// fill with middle in the centre, so that only the full hash tells files
+// with different middles apart.
+func big(fill, middle byte) []byte {
+	data := bytes.Repeat([]byte{fill}, 3*edgeSize)
+	data[len(data)/2] = middle
+	return data
+}
+
+func TestFindStages(t *testing.T) {
+	same := big('a', 'x')
+	files := fstest.MapFS{
+		"big1":    {Data: same},
+		"big2":    {Data: same},
+		"big3":    {Data: big('a', 'y')},
+		"other1":  {Data: big('b', 'x')},
+		"small1":  {Data: []byte("hello")},
+		"small2":  {Data: []byte("hello")},
+		"small3":  {Data: []byte("world")},
+		"unique":  {Data: []byte("no other file is this long")},
+		"unique2": {Data: make([]byte, 3*edgeSize+1)},
+	}
+	f, fsys := newFinder(files, 0)
+	stats := f.Find()
+
+	want := []types.DuplicateSet{
+		{Size: 3 * edgeSize, SHA256: sum(same), WastedBytes: 3 * edgeSize, Paths: []string{"big1", "big2"}},
+		{Size: 5, SHA256: sum([]byte("hello")), WastedBytes: 5, Paths: []string{"small1", "small2"}},
+	}
+	if !reflect.DeepEqual(stats.Sets, want) {
+		t.Errorf("Sets =\n%+v\nwant\n%+v", stats.Sets, want)
+	}
+	if stats.Files != 4 || stats.WastedBytes != 3*edgeSize+5 || stats.Errors != 0 {
+		t.Errorf("Files, WastedBytes, Errors = %d, %d, %d, want 4, %d, 0", stats.Files, stats.WastedBytes, stats.Errors, 3*edgeSize+5)
+	}
+
+	wantOpens := map[string]int{
+		// Files of a size no other file has are never read.
+		"unique": 0, "unique2": 0,
+		// other1 differs at its edges, so the partial hash rules it out.
+		"other1": 1,
+		// The partial hash matches for all three, and only reading them
+		// whole tells big3 apart.
+		"big1": 2, "big2": 2, "big3": 2,
+		// Small files are read whole by the partial hash and not again.
+		"small1": 1, "small2": 1, "small3": 1,
+	}
+	for path, want := range wantOpens {
+		if got := fsys.opens[path]; got != want {
+			t.Errorf("%s opened %d times, want %d", path, got, want)
+		}
+	}
+}
+
+func TestFindSmallShortcutBoundary(t *testing.T) {
+	// At exactly two edges the partial hash covers the whole file; one
+	// byte more and the middle byte is left to the full hash.
+	edge := bytes.Repeat([]byte{'e'}, 2*edgeSize)
+	longer := func(middle byte) []byte {
+		data := bytes.Repeat([]byte{'e'}, 2*edgeSize+1)
+		data[edgeSize] = middle
+		return data
+	}
+	files := fstest.MapFS{
+		"edge1": {Data: edge},
+		"edge2": {Data: edge},
+		"long1": {Data: longer('x')},
+		"long2": {Data: longer('y')},
+	}
+	f, fsys := newFinder(files, 0)
+	stats := f.Find()
+
+	if len(stats.Sets) != 1 || !reflect.DeepEqual(stats.Sets[0].Paths, []string{"edge1", "edge2"}) {
+		t.Errorf("Sets = %+v, want only edge1 and edge2", stats.Sets)
+	}
+	if fsys.opens["edge1"] != 1 || fsys.opens["long1"] != 2 {
+		t.Errorf("edge1, long1 opened %d, %d times, want 1, 2", fsys.opens["edge1"], fsys.opens["long1"])
+	}
+}
+
+func TestAddSkipsLinksAndSmallFiles(t *testing.T) {
+	data := []byte("duplicate contents")
+	files := fstest.MapFS{
+		"a":     {Data: data},
+		"b":     {Data: data},
+		"c":     {Data: data},
+		"d":     {Data: data},
+		"tiny1": {Data: []byte("x")},
+		"tiny2": {Data: []byte("x")},
+	}
+	f := NewFinder(files, 2)
+
+	link := func(path string, ino uint64) types.FileInfo {
+		info := regular(path, int64(len(data)))
+		info.Device, info.Inode, info.Links = 1, ino, 2
+		return info
+	}
+	// a and b are hard links to one file; c is reached twice, as through
+	// a followed symbolic link, without being linked.
+	f.Add(link("a", 10))
+	f.Add(link("b", 10))
+	f.Add(link("c", 11))
+	f.Add(link("c", 11))
+	f.Add(regular("d", int64(len(data))))
+	f.Add(regular("tiny1", 1))
+	f.Add(regular("tiny2", 1))
+	// Neither directories nor archive members are candidates.
+	f.Add(types.FileInfo{Path: "dir", Size: int64(len(data)), Mode: fs.ModeDir | 0o755, IsDir: true})
+	f.Add(types.FileInfo{Path: "x.zip/a", Size: int64(len(data)), Mode: 0o644, Archive: "x.zip"})
+
+	stats := f.Find()
+	if stats.HardLinksSkipped != 2 {
+		t.Errorf("HardLinksSkipped = %d, want 2", stats.HardLinksSkipped)
+	}
+	if len(stats.Sets) != 1 || !reflect.DeepEqual(stats.Sets[0].Paths, []string{"a", "c", "d"}) {
+		t.Errorf("Sets = %+v, want one set of a, c and d", stats.Sets)
+	}
+	if stats.Errors != 0 {
+		t.Errorf("Errors = %d, want 0", stats.Errors)
+	}
+}
+
+func TestEmptyFilesAreNeverDuplicates(t *testing.T) {
+	f := NewFinder(fstest.MapFS{"e1": {}, "e2": {}}, 0)
+	f.Add(regular("e1", 0))
+	f.Add(regular("e2", 0))
+	if stats := f.Find(); len(stats.Sets) != 0 {
+		t.Errorf("Sets = %+v, want none", stats.Sets)
+	}
+}
+
+func TestFindReadError(t *testing.T) {
+	files := fstest.MapFS{
+		"a": {Data: []byte("same")},
+		"b": {Data: []byte("same")},
+	}
+	f := NewFinder(files, 0)
+	f.Add(regular("a", 4))
+	f.Add(regular("b", 4))
+	// Deleted after the scan saw it.
+	f.Add(regular("gone", 4))
+
+	stats := f.Find()
+	if stats.Errors != 1 {
+		t.Errorf("Errors = %d, want 1", stats.Errors)
+	}
+	if len(stats.Sets) != 1 || !reflect.DeepEqual(stats.Sets[0].Paths, []string{"a", "b"}) {
+		t.Errorf("Sets = %+v, want one set of a and b", stats.Sets)
+	}
+}
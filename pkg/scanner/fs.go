@@ -0,0 +1,133 @@
+package scanner
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FS is the filesystem a Scanner reads. It is an io/fs.FS that can also
+// describe symbolic links without following them. Names are the paths the
+// scanner builds with filepath.Join from the roots passed to Start, so for
+// anything but the OS the root is usually ".".
+//
+// If an FS also implements ReadDir (fs.ReadDirFS), Stat (fs.StatFS) or
+// ReadLink(name string) (string, error), those are used instead of the
+// generic fallbacks.
+type FS interface {
+	fs.FS
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// OSFS reads the operating system's filesystem. It is the default.
+type OSFS struct{}
+
+func (OSFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+func (OSFS) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (OSFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// ReadDir returns the entries of a directory sorted by name, as
+// fs.ReadDirFS requires.
+func (OSFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (OSFS) ReadLink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+// FromFS adapts fsys for scanning. The root to pass to Start is ".". Names
+// are converted to slash-separated paths, and if fsys has no Lstat method,
+// Stat is used in its place, which is right for filesystems without
+// symbolic links such as embed.FS.
+func FromFS(fsys fs.FS) FS {
+	return ioFS{fsys}
+}
+
+type ioFS struct {
+	fsys fs.FS
+}
+
+func (f ioFS) Open(name string) (fs.File, error) {
+	return f.fsys.Open(filepath.ToSlash(name))
+}
+
+func (f ioFS) Lstat(name string) (fs.FileInfo, error) {
+	if l, ok := f.fsys.(interface {
+		Lstat(string) (fs.FileInfo, error)
+	}); ok {
+		return l.Lstat(filepath.ToSlash(name))
+	}
+	return fs.Stat(f.fsys, filepath.ToSlash(name))
+}
+
+func (f ioFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(f.fsys, filepath.ToSlash(name))
+}
+
+func (f ioFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(f.fsys, filepath.ToSlash(name))
+}
+
+func (f ioFS) ReadLink(name string) (string, error) {
+	if l, ok := f.fsys.(interface {
+		ReadLink(string) (string, error)
+	}); ok {
+		return l.ReadLink(filepath.ToSlash(name))
+	}
+	return "", &fs.PathError{Op: "readlink", Path: name, Err: errors.ErrUnsupported}
+}
+
+func (s *Scanner) lstat(name string) (fs.FileInfo, error) {
+	return s.fs.Lstat(name)
+}
+
+// stat follows symbolic links. Filesystems that can't are assumed to have
+// none, so Lstat is as good.
+func (s *Scanner) stat(name string) (fs.FileInfo, error) {
+	if f, ok := s.fs.(fs.StatFS); ok {
+		return f.Stat(name)
+	}
+	return s.fs.Lstat(name)
+}
+
+func (s *Scanner) readDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(s.fs, name)
+}
+
+func (s *Scanner) readLink(name string) (string, error) {
+	if f, ok := s.fs.(interface {
+		ReadLink(string) (string, error)
+	}); ok {
+		return f.ReadLink(name)
+	}
+	return "", &fs.PathError{Op: "readlink", Path: name, Err: errors.ErrUnsupported}
+}
+
+// isOS reports whether the scanner reads the live OS filesystem, where
+// absolute paths, the mount table and device numbers mean something.
+func (s *Scanner) isOS() bool {
+	_, ok := s.fs.(OSFS)
+	return ok
+}
+
+// absPath makes path absolute for the mount table and the system path
+// prefixes. Paths in any other filesystem are left as they are.
+func (s *Scanner) absPath(path string) string {
+	if !s.isOS() {
+		return path
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
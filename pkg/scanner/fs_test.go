@@ -0,0 +1,198 @@
+package scanner
+
+import (
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"file-counter/pkg/scanner/types"
+)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"README.md":             {Data: []byte("readme")},
+		"src/main.go":           {Data: []byte("package main")},
+		"src/util/strings.go":   {Data: []byte("package util")},
+		"src/util/strings.tmp":  {Data: []byte("tmp")},
+		"build/out.bin":         {Data: []byte("binary")},
+		"docs/guide/intro.txt":  {Data: []byte("intro")},
+		"docs/guide/deep/a.txt": {Data: []byte("a")},
+	}
+}
+
+// scanFS scans fsys from its root and returns the result and every entry
+// passed to the visitor, keyed by path.
+func scanFS(t *testing.T, fsys fstest.MapFS, opts ...Option) (*types.ScanResult, map[string]types.FileInfo) {
+	t.Helper()
+	var mu sync.Mutex
+	seen := make(map[string]types.FileInfo)
+	opts = append([]Option{
+		WithFS(FromFS(fsys)),
+		WithQuiet(true),
+		WithProgressWriter(io.Discard),
+		WithVisitor(func(info types.FileInfo) {
+			mu.Lock()
+			seen[info.Path] = info
+			mu.Unlock()
+		}),
+	}, opts...)
+	s := NewScanner(opts...)
+	defer s.Stop()
+	return s.Start("."), seen
+}
+
+func paths(entries map[string]types.FileInfo) string {
+	var list []string
+	for path := range entries {
+		list = append(list, path)
+	}
+	sort.Strings(list)
+	return strings.Join(list, " ")
+}
+
+func TestFromFSWalk(t *testing.T) {
+	result, seen := scanFS(t, testFS(), WithoutDefaultExcludes())
+
+	want := ". README.md build build/out.bin docs docs/guide docs/guide/deep docs/guide/deep/a.txt " +
+		"docs/guide/intro.txt src src/main.go src/util src/util/strings.go src/util/strings.tmp"
+	if got := paths(seen); got != want {
+		t.Errorf("visited %s\nwant    %s", got, want)
+	}
+	if result.TotalFiles != 7 {
+		t.Errorf("TotalFiles = %d, want 7", result.TotalFiles)
+	}
+	if want := int64(len("readme") + len("package main") + len("package util") + len("tmp") +
+		len("binary") + len("intro") + len("a")); result.TotalSize != want {
+		t.Errorf("TotalSize = %d, want %d", result.TotalSize, want)
+	}
+	if result.TotalErrors != 0 {
+		t.Errorf("TotalErrors = %d, want 0", result.TotalErrors)
+	}
+}
+
+func TestFromFSExcludes(t *testing.T) {
+	result, seen := scanFS(t, testFS(),
+		WithoutDefaultExcludes(),
+		WithExcludes("build", "*.tmp", "docs/guide/deep", "*.go"),
+		WithIncludes("main.go"),
+	)
+
+	for _, path := range []string{"build/out.bin", "src/util/strings.tmp", "src/util/strings.go", "docs/guide/deep", "docs/guide/deep/a.txt"} {
+		if _, ok := seen[path]; ok {
+			t.Errorf("%s was scanned, want it excluded", path)
+		}
+	}
+	for _, path := range []string{"docs/guide/intro.txt", "src/main.go"} {
+		if _, ok := seen[path]; !ok {
+			t.Errorf("%s was excluded", path)
+		}
+	}
+
+	skipped := make(map[string]string)
+	for _, s := range result.Skipped {
+		skipped[s.Path] = s.Reason
+	}
+	for _, path := range []string{"build", "src/util/strings.tmp", "src/util/strings.go", "docs/guide/deep"} {
+		if skipped[path] != types.SkipUserExclude {
+			t.Errorf("%s skipped with reason %q, want %q", path, skipped[path], types.SkipUserExclude)
+		}
+	}
+}
+
+func TestFromFSIgnoreFiles(t *testing.T) {
+	fsys := testFS()
+	fsys[".gitignore"] = &fstest.MapFile{Data: []byte("build/\n*.tmp\n")}
+	fsys["docs/.gitignore"] = &fstest.MapFile{Data: []byte("/guide/*\n!/guide/intro.txt\n")}
+
+	result, seen := scanFS(t, fsys, WithIgnoreFiles(".gitignore"))
+
+	for _, path := range []string{"build", "src/util/strings.tmp", "docs/guide/deep"} {
+		if _, ok := seen[path]; ok {
+			t.Errorf("%s was scanned, want it ignored", path)
+		}
+	}
+	for _, path := range []string{"docs/guide/intro.txt", "src/util/strings.go"} {
+		if _, ok := seen[path]; !ok {
+			t.Errorf("%s was ignored", path)
+		}
+	}
+	if result.Ignored.Dirs != 2 || result.Ignored.Files != 1 {
+		t.Errorf("Ignored = %+v, want 2 directories and 1 file", result.Ignored)
+	}
+}
+
+func TestFromFSDepth(t *testing.T) {
+	result, seen := scanFS(t, testFS(), WithoutDefaultExcludes(), WithMaxDepth(1))
+
+	depths := map[string]int{
+		".":                     0,
+		"README.md":             1,
+		"src/main.go":           2,
+		"docs/guide":            2,
+		"docs/guide/deep/a.txt": 4,
+	}
+	for path, want := range depths {
+		if got := seen[path].Depth; got != want {
+			t.Errorf("%s has depth %d, want %d", path, got, want)
+		}
+	}
+
+	if len(result.TopDirectories) == 0 {
+		t.Fatal("no directories ranked")
+	}
+	for _, dir := range result.TopDirectories {
+		if strings.Count(dir.Path, "/") > 0 {
+			t.Errorf("directory %s is ranked below -max-depth 1", dir.Path)
+		}
+	}
+}
+
+// failingFS fails to open or list the paths in fail.
+type failingFS struct {
+	fstest.MapFS
+	fail map[string]bool
+}
+
+func (f failingFS) Open(name string) (fs.File, error) {
+	if f.fail[name] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return f.MapFS.Open(name)
+}
+
+func (f failingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if f.fail[name] {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrPermission}
+	}
+	return f.MapFS.ReadDir(name)
+}
+
+func TestFromFSErrors(t *testing.T) {
+	fsys := testFS()
+	fsys["docs/.gitignore"] = &fstest.MapFile{Data: []byte("*.txt\n")}
+	fsys["bad.zip"] = &fstest.MapFile{Data: []byte("not a zip archive")}
+
+	s := NewScanner(
+		WithFS(FromFS(failingFS{fsys, map[string]bool{"build": true, "docs/.gitignore": true}})),
+		WithQuiet(true),
+		WithProgressWriter(io.Discard),
+		WithoutDefaultExcludes(),
+		WithIgnoreFiles(".gitignore"),
+		WithArchives(true),
+	)
+	defer s.Stop()
+	result := s.Start("src", "docs", "build", "bad.zip", "missing")
+
+	// The missing root, the unreadable directory, the unreadable ignore
+	// file and the broken archive.
+	if result.TotalErrors != 4 {
+		t.Errorf("TotalErrors = %d, want 4", result.TotalErrors)
+	}
+	if result.TotalFiles != 7 {
+		t.Errorf("TotalFiles = %d, want 7", result.TotalFiles)
+	}
+}
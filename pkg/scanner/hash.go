@@ -0,0 +1,114 @@
+package scanner
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"hash/crc32"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"golang.org/x/crypto/blake2b"
+)
+
+// HashAlgorithms lists the digests WithHash accepts. blake2b is
+// BLAKE2b-512, as written by b2sum; xxhash is XXH64 and crc32 the IEEE
+// polynomial used by gzip and zip. The last two are fast but only guard
+// against accidental corruption.
+var HashAlgorithms = []string{"sha256", "sha1", "blake2b", "xxhash", "crc32"}
+
+var hashes = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha1":   sha1.New,
+	"blake2b": func() hash.Hash {
+		h, _ := blake2b.New512(nil)
+		return h
+	},
+	"xxhash": func() hash.Hash { return xxhash.New() },
+	"crc32":  func() hash.Hash { return crc32.NewIEEE() },
+}
+
+var hashBuffers = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 64*1024)
+		return &buf
+	},
+}
+
+// rateLimiter spreads reads over time so that all workers together stay
+// under a number of bytes per second.
+type rateLimiter struct {
+	mu   sync.Mutex
+	rate float64
+	next time.Time
+}
+
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: float64(bytesPerSecond)}
+}
+
+// wait blocks until n more bytes fit in the budget.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+	l.mu.Unlock()
+
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// hashFile returns the hex digest of a file's contents with the configured
+// algorithm, reading no faster than the hash rate allows.
+func (s *Scanner) hashFile(path string) (string, error) {
+	f, err := s.fs.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := s.newHash()
+	bufp := hashBuffers.Get().(*[]byte)
+	defer hashBuffers.Put(bufp)
+	buf := *bufp
+
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if s.hashLimiter != nil {
+				if err := s.hashLimiter.wait(s.ctx, n); err != nil {
+					return "", err
+				}
+			}
+			h.Write(buf[:n])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
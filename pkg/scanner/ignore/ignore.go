@@ -0,0 +1,219 @@
+// Package ignore implements gitignore-style pattern matching for the
+// .gitignore, .ignore and .fsscanignore files found while walking a tree.
+package ignore
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var DefaultFileNames = []string{".gitignore", ".ignore", ".fsscanignore"}
+
+type pattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Matcher holds the patterns of the ignore files in one directory. Patterns
+// are matched against paths relative to that directory.
+type Matcher struct {
+	base     string
+	patterns []pattern
+}
+
+// LoadFS reads the named ignore files in dir from fsys, in order, into one
+// Matcher so that later files override earlier ones. It returns nil if
+// none of the files exist or they contain no patterns. dir is joined with
+// each name using filepath.Join, so it must be a name fsys understands.
+func LoadFS(fsys fs.FS, dir string, names []string) (*Matcher, error) {
+	m := &Matcher{base: dir}
+	for _, name := range names {
+		f, err := fsys.Open(filepath.Join(dir, name))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		err = m.parse(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(m.patterns) == 0 {
+		return nil, nil
+	}
+	return m, nil
+}
+
+// Parse reads patterns from r for a Matcher rooted at base.
+func Parse(r io.Reader, base string) (*Matcher, error) {
+	m := &Matcher{base: base}
+	if err := m.parse(r); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Matcher) parse(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if p, ok := compile(scanner.Text()); ok {
+			m.patterns = append(m.patterns, p)
+		}
+	}
+	return scanner.Err()
+}
+
+// Match reports whether any pattern matches path and, if so, whether the
+// last matching pattern ignores it (as opposed to re-including it with !).
+func (m *Matcher) Match(path string, isDir bool) (matched, ignored bool) {
+	rel, err := filepath.Rel(m.base, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false, false
+	}
+	rel = filepath.ToSlash(rel)
+
+	for i := len(m.patterns) - 1; i >= 0; i-- {
+		p := m.patterns[i]
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.re.MatchString(rel) {
+			return true, !p.negate
+		}
+	}
+	return false, false
+}
+
+// Stack chains the matchers from the scan root down to a directory. Deeper
+// matchers take precedence over their parents, as in git.
+type Stack struct {
+	parent  *Stack
+	matcher *Matcher
+}
+
+// Push returns a stack with m on top. A nil m returns s unchanged.
+func (s *Stack) Push(m *Matcher) *Stack {
+	if m == nil {
+		return s
+	}
+	return &Stack{parent: s, matcher: m}
+}
+
+// Ignored reports whether path is ignored by the closest matcher that has
+// an opinion about it. A nil Stack ignores nothing.
+func (s *Stack) Ignored(path string, isDir bool) bool {
+	for st := s; st != nil; st = st.parent {
+		if matched, ignored := st.matcher.Match(path, isDir); matched {
+			return ignored
+		}
+	}
+	return false
+}
+
+func compile(line string) (pattern, bool) {
+	line = trimTrailingSpaces(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pattern{}, false
+	}
+
+	var p pattern
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return pattern{}, false
+	}
+
+	// A slash anywhere but at the end anchors the pattern to the directory
+	// of the ignore file; otherwise it matches at any depth.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	if !anchored && !strings.HasPrefix(line, "**") {
+		expr.WriteString("(?:.*/)?")
+	}
+	expr.WriteString(globToRegexp(line))
+	// A match on a directory covers everything below it.
+	expr.WriteString("(?:/.*)?$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return pattern{}, false
+	}
+	p.re = re
+	return p, true
+}
+
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				leading := i == 0 || glob[i-1] == '/'
+				trailing := i+2 == len(glob) || glob[i+2] == '/'
+				if leading && trailing {
+					i++
+					if i+1 < len(glob) {
+						// "**/" matches zero or more directories.
+						i++
+						b.WriteString("(?:.*/)?")
+					} else {
+						b.WriteString(".*")
+					}
+					continue
+				}
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+func trimTrailingSpaces(line string) string {
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return strings.ReplaceAll(line, `\ `, " ")
+}
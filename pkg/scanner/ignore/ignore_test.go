@@ -0,0 +1,143 @@
+package ignore
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		// Unanchored patterns match at any depth.
+		{"*.log", "a.log", false, true},
+		{"*.log", "x/y/a.log", false, true},
+		{"*.log", "a.log.txt", false, false},
+		{"build", "build", true, true},
+		{"build", "src/build", true, true},
+		{"build", "build/out/a.o", false, true},
+
+		// A leading or inner slash anchors the pattern.
+		{"/build", "build", true, true},
+		{"/build", "src/build", true, false},
+		{"doc/*.txt", "doc/a.txt", false, true},
+		{"doc/*.txt", "x/doc/a.txt", false, false},
+		{"doc/*.txt", "doc/sub/a.txt", false, false},
+
+		// ** spans directories.
+		{"**/logs", "logs", true, true},
+		{"**/logs", "a/b/logs", true, true},
+		{"a/**/b", "a/b", true, true},
+		{"a/**/b", "a/x/y/b", true, true},
+		{"a/**", "a/x/y", false, true},
+		{"a/**", "b/a/x", false, false},
+
+		// A trailing slash only matches directories, and what is below
+		// them.
+		{"tmp/", "tmp", true, true},
+		{"tmp/", "tmp", false, false},
+		{"tmp/", "x/tmp", true, true},
+
+		{"?.c", "a.c", false, true},
+		{"?.c", "ab.c", false, false},
+		{"[ab].c", "b.c", false, true},
+		{"[!ab].c", "b.c", false, false},
+		{`\#notes`, "#notes", false, true},
+		{`\!important`, "!important", false, true},
+		{`trailing\ `, "trailing ", false, true},
+	}
+	for _, tt := range tests {
+		p, ok := compile(tt.pattern)
+		if !ok {
+			t.Errorf("compile(%q) failed", tt.pattern)
+			continue
+		}
+		got := !(p.dirOnly && !tt.isDir) && p.re.MatchString(tt.path)
+		if got != tt.want {
+			t.Errorf("%q matches %q (dir %v) = %v, want %v", tt.pattern, tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestCompileSkipsBlankAndComments(t *testing.T) {
+	for _, line := range []string{"", "   ", "# comment", "/", "!"} {
+		if _, ok := compile(line); ok {
+			t.Errorf("compile(%q) returned a pattern", line)
+		}
+	}
+	if p, _ := compile("!keep.log"); !p.negate {
+		t.Errorf("compile(%q) isn't negated", "!keep.log")
+	}
+}
+
+func TestMatcherNegation(t *testing.T) {
+	m, err := Parse(strings.NewReader("*.log\n!keep.log\nout/\n"), "/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path             string
+		isDir            bool
+		matched, ignored bool
+	}{
+		{"/repo/a.log", false, true, true},
+		{"/repo/sub/keep.log", false, true, false},
+		{"/repo/out", true, true, true},
+		{"/repo/out", false, false, false},
+		{"/repo/a.txt", false, false, false},
+		{"/repo", true, false, false},
+		{"/elsewhere/a.log", false, false, false},
+	}
+	for _, tt := range tests {
+		matched, ignored := m.Match(tt.path, tt.isDir)
+		if matched != tt.matched || ignored != tt.ignored {
+			t.Errorf("Match(%q, %v) = %v, %v, want %v, %v", tt.path, tt.isDir, matched, ignored, tt.matched, tt.ignored)
+		}
+	}
+}
+
+func TestStackDeeperWins(t *testing.T) {
+	root, _ := Parse(strings.NewReader("*.gen\n"), "/repo")
+	sub, _ := Parse(strings.NewReader("!*.gen\n"), "/repo/keep")
+	var s *Stack
+	s = s.Push(root).Push(sub)
+
+	if !s.Ignored("/repo/a.gen", false) {
+		t.Errorf("/repo/a.gen isn't ignored")
+	}
+	if s.Ignored("/repo/keep/a.gen", false) {
+		t.Errorf("/repo/keep/a.gen is ignored despite the deeper negation")
+	}
+	if (*Stack)(nil).Ignored("/repo/a.gen", false) {
+		t.Errorf("a nil Stack ignores paths")
+	}
+}
+
+func TestLoadFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"repo/.gitignore": {Data: []byte("*.log\n")},
+		"repo/.ignore":    {Data: []byte("!keep.log\n")},
+		"other/.ignore":   {Data: []byte("# only a comment\n")},
+	}
+
+	// Later files override earlier ones, and missing ones are skipped.
+	m, err := LoadFS(fsys, "repo", []string{".gitignore", ".fsscanignore", ".ignore"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ignored := m.Match("repo/a.log", false); !ignored {
+		t.Errorf("repo/a.log isn't ignored")
+	}
+	if _, ignored := m.Match("repo/keep.log", false); ignored {
+		t.Errorf("repo/keep.log is ignored despite .ignore")
+	}
+
+	if m, err := LoadFS(fsys, "other", DefaultFileNames); m != nil || err != nil {
+		t.Errorf("LoadFS without patterns = %v, %v, want nil, nil", m, err)
+	}
+}
@@ -0,0 +1,50 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"path/filepath"
+
+	"file-counter/pkg/scanner/types"
+)
+
+// StartFromList scans the paths read from r instead of walking a tree.
+// Paths are separated by newlines, or by NUL bytes if nul is set, as
+// written by find -print0 or git ls-files -z. Directories in the list are
+// counted, but not descended into. The error is the one that stopped
+// reading r, if any; the result covers everything read before it.
+func (s *Scanner) StartFromList(r io.Reader, nul bool) (*types.ScanResult, error) {
+	lines := bufio.NewScanner(r)
+	lines.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	if nul {
+		lines.Split(scanNul)
+	}
+
+	result := s.run(func(entries chan<- entry) {
+		for lines.Scan() {
+			if lines.Text() == "" {
+				continue
+			}
+			path := filepath.Clean(lines.Text())
+			s.setCurrentPath(path)
+			select {
+			case entries <- entry{path: path}:
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	})
+	return result, lines.Err()
+}
+
+// scanNul is a bufio.SplitFunc for NUL-terminated records.
+func scanNul(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,102 @@
+package scanner
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Filesystem classes reported by FSClass. They can be used in place of a
+// filesystem type wherever types are accepted, e.g. SkipFSTypes.
+const (
+	FSClassPseudo  = "pseudo"
+	FSClassMemory  = "memory"
+	FSClassOverlay = "overlay"
+	FSClassNetwork = "network"
+	FSClassFuse    = "fuse"
+	FSClassDisk    = "disk"
+)
+
+// DefaultSkipFSTypes are kernel pseudo filesystems whose contents aren't
+// files on any disk. They are skipped unless default excludes are disabled.
+var DefaultSkipFSTypes = []string{
+	"proc", "sysfs", "devtmpfs", "devpts", "cgroup", "cgroup2",
+	"securityfs", "debugfs", "tracefs", "pstore", "bpf", "configfs",
+	"fusectl", "mqueue", "hugetlbfs", "autofs", "binfmt_misc",
+	"efivarfs", "rpc_pipefs", "nsfs", "selinuxfs",
+}
+
+type Mount struct {
+	MountPoint string
+	FSType     string
+	Source     string
+}
+
+func FSClass(fstype string) string {
+	switch fstype {
+	case "tmpfs", "ramfs":
+		return FSClassMemory
+	case "overlay", "overlayfs", "aufs", "unionfs":
+		return FSClassOverlay
+	case "nfs", "nfs4", "cifs", "smb3", "smbfs", "9p", "afs", "ceph", "glusterfs", "lustre", "fuse.sshfs":
+		return FSClassNetwork
+	}
+	if fstype == "fuse" || fstype == "fuseblk" || strings.HasPrefix(fstype, "fuse.") {
+		return FSClassFuse
+	}
+	for _, pseudo := range DefaultSkipFSTypes {
+		if fstype == pseudo {
+			return FSClassPseudo
+		}
+	}
+	return FSClassDisk
+}
+
+// ParseMountInfo reads the /proc/<pid>/mountinfo format described in
+// proc(5). Malformed lines are ignored.
+func ParseMountInfo(r io.Reader) ([]Mount, error) {
+	var mounts []Mount
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// The optional fields end at a lone "-", followed by the
+		// filesystem type and the mount source.
+		sep := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if len(fields) < 5 || sep < 0 || sep+2 >= len(fields) {
+			continue
+		}
+		mounts = append(mounts, Mount{
+			MountPoint: unescapeMountField(fields[4]),
+			FSType:     fields[sep+1],
+			Source:     unescapeMountField(fields[sep+2]),
+		})
+	}
+	return mounts, scanner.Err()
+}
+
+// unescapeMountField decodes the octal escapes (\040 for a space and so on)
+// the kernel uses for whitespace and backslashes in mountinfo.
+func unescapeMountField(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+3 < len(field) {
+			if n, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(field[i])
+	}
+	return b.String()
+}
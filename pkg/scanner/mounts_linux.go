@@ -0,0 +1,13 @@
+package scanner
+
+import "os"
+
+// ReadMounts returns the mount table of the current process.
+func ReadMounts() ([]Mount, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseMountInfo(f)
+}
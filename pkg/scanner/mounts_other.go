@@ -0,0 +1,11 @@
+//go:build !linux
+
+package scanner
+
+import "errors"
+
+// ReadMounts returns the mount table of the current process. It is only
+// implemented on Linux; elsewhere the scanner falls back to DefaultSkipPaths.
+func ReadMounts() ([]Mount, error) {
+	return nil, errors.New("mount table not available on this platform")
+}
@@ -0,0 +1,70 @@
+package scanner
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMountInfo(t *testing.T) {
+	const mountinfo = `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+23 22 0:21 / /proc rw,nosuid,nodev,noexec,relatime shared:12 - proc proc rw
+24 22 0:22 / /run/user/1000 rw,nosuid,nodev shared:5 master:1 - tmpfs tmpfs rw,size=100k
+25 22 0:45 / /mnt/my\040disk rw,relatime - fuse.sshfs me@host:/home\040dir rw
+26 22 0:46 / /no/separator rw,relatime ext4 /dev/sdb1 rw
+27 22 0:47 / /short rw -
+
+28 22 0:48 / /srv rw - nfs4 server:/export rw
+`
+	mounts, err := ParseMountInfo(strings.NewReader(mountinfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Mount{
+		{MountPoint: "/", FSType: "ext4", Source: "/dev/sda1"},
+		{MountPoint: "/proc", FSType: "proc", Source: "proc"},
+		{MountPoint: "/run/user/1000", FSType: "tmpfs", Source: "tmpfs"},
+		{MountPoint: "/mnt/my disk", FSType: "fuse.sshfs", Source: "me@host:/home dir"},
+		{MountPoint: "/srv", FSType: "nfs4", Source: "server:/export"},
+	}
+	if !reflect.DeepEqual(mounts, want) {
+		t.Errorf("ParseMountInfo =\n%+v\nwant\n%+v", mounts, want)
+	}
+}
+
+func TestUnescapeMountField(t *testing.T) {
+	tests := map[string]string{
+		`/plain`:          "/plain",
+		`/a\040b`:         "/a b",
+		`/tab\011here`:    "/tab\there",
+		`/back\134slash`:  `/back\slash`,
+		`/not\08escape`:   `/not\08escape`,
+		`/cut\04`:         `/cut\04`,
+		`\040\040leading`: "  leading",
+	}
+	for in, want := range tests {
+		if got := unescapeMountField(in); got != want {
+			t.Errorf("unescapeMountField(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFSClass(t *testing.T) {
+	tests := map[string]string{
+		"ext4":       FSClassDisk,
+		"proc":       FSClassPseudo,
+		"cgroup2":    FSClassPseudo,
+		"tmpfs":      FSClassMemory,
+		"overlay":    FSClassOverlay,
+		"nfs4":       FSClassNetwork,
+		"fuse.sshfs": FSClassNetwork,
+		"fuse.gvfsd": FSClassFuse,
+		"fuseblk":    FSClassFuse,
+	}
+	for fstype, want := range tests {
+		if got := FSClass(fstype); got != want {
+			t.Errorf("FSClass(%q) = %q, want %q", fstype, got, want)
+		}
+	}
+}
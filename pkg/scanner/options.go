@@ -0,0 +1,206 @@
+package scanner
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"time"
+
+	"file-counter/pkg/scanner/types"
+)
+
+var DefaultSkipDirs = []string{
+	".git", "node_modules", ".npm", "venv", ".venv", "env", ".env",
+	"target", "build", "dist", ".next", ".nuxt", "coverage", ".coverage",
+	".vscode", ".idea", "__pycache__", ".pytest_cache", "site-packages",
+	"vendor", ".vendor", "cache", ".cache",
+}
+
+// DefaultSkipPaths is used instead of the mount table where it can't be
+// read (anywhere but Linux).
+var DefaultSkipPaths = []string{
+	"/proc", "/sys", "/dev", "/run", "/tmp",
+	"/var/run", "/var/lock", "/var/tmp",
+}
+
+type Options struct {
+	Workers           int
+	Walkers           int
+	TopN              int
+	DirectorySort     string
+	SizeMode          string
+	Symlinks          string
+	ProgressInterval  time.Duration
+	SkipDirs          []string
+	SkipPaths         []string
+	SkipFSTypes       []string
+	Excludes          []string
+	Includes          []string
+	NoDefaultExcludes bool
+	IgnoreFiles       []string
+	MaxDepth          int
+	OneFileSystem     bool
+	Archives          bool
+	Hash              string
+	HashRate          int64
+	Quiet             bool
+	FS                FS
+	Analyzer          types.FileAnalyzer
+	ProgressWriter    io.Writer
+	Visitor           func(types.FileInfo)
+}
+
+type Option func(*Options)
+
+func DefaultOptions() Options {
+	return Options{
+		Workers:          runtime.GOMAXPROCS(0) * 2,
+		TopN:             5,
+		DirectorySort:    types.DirSortDirect,
+		SizeMode:         types.SizeApparent,
+		Symlinks:         types.SymlinkPhysical,
+		ProgressInterval: 50 * time.Millisecond,
+		SkipDirs:         DefaultSkipDirs,
+		ProgressWriter:   os.Stdout,
+		FS:               OSFS{},
+	}
+}
+
+func WithWorkers(n int) Option {
+	return func(o *Options) { o.Workers = n }
+}
+
+// WithWalkers sets how many goroutines read directories in parallel. It
+// defaults to the number of workers.
+func WithWalkers(n int) Option {
+	return func(o *Options) { o.Walkers = n }
+}
+
+func WithTopN(n int) Option {
+	return func(o *Options) { o.TopN = n }
+}
+
+// WithDirectorySort ranks directories by their direct size
+// (types.DirSortDirect) or by the size of their whole subtree
+// (types.DirSortRecursive).
+func WithDirectorySort(mode string) Option {
+	return func(o *Options) { o.DirectorySort = mode }
+}
+
+// WithSizeMode picks apparent sizes (types.SizeApparent) or allocated disk
+// usage (types.SizeDisk) for extremes and directory rankings.
+func WithSizeMode(mode string) Option {
+	return func(o *Options) { o.SizeMode = mode }
+}
+
+// WithSymlinks sets how symbolic links are handled: left out
+// (types.SymlinkSkip), counted as links (types.SymlinkPhysical) or followed
+// (types.SymlinkFollow), in which case each directory is read only once.
+func WithSymlinks(mode string) Option {
+	return func(o *Options) { o.Symlinks = mode }
+}
+
+func WithProgressInterval(d time.Duration) Option {
+	return func(o *Options) { o.ProgressInterval = d }
+}
+
+// WithSkipDirs replaces the directory names that are never descended into.
+func WithSkipDirs(names ...string) Option {
+	return func(o *Options) { o.SkipDirs = append([]string{}, names...) }
+}
+
+// WithSkipPaths sets path prefixes that are always skipped, in addition to
+// the filesystem types from the mount table.
+func WithSkipPaths(paths ...string) Option {
+	return func(o *Options) { o.SkipPaths = append([]string{}, paths...) }
+}
+
+// WithSkipFSTypes skips mount points whose filesystem type, or class as
+// reported by FSClass, is one of fstypes, in addition to DefaultSkipFSTypes.
+func WithSkipFSTypes(fstypes ...string) Option {
+	return func(o *Options) { o.SkipFSTypes = append(o.SkipFSTypes, fstypes...) }
+}
+
+func WithExcludes(patterns ...string) Option {
+	return func(o *Options) { o.Excludes = append(o.Excludes, patterns...) }
+}
+
+// WithIncludes keeps paths matching any of the patterns even when an
+// exclude pattern or a built-in skip rule would leave them out.
+func WithIncludes(patterns ...string) Option {
+	return func(o *Options) { o.Includes = append(o.Includes, patterns...) }
+}
+
+// WithoutDefaultExcludes turns off DefaultSkipDirs, DefaultSkipFSTypes and
+// DefaultSkipPaths while keeping any user excludes.
+func WithoutDefaultExcludes() Option {
+	return func(o *Options) { o.NoDefaultExcludes = true }
+}
+
+// WithIgnoreFiles honors gitignore-style files with the given names (for
+// example ignore.DefaultFileNames) in every directory walked. When enabled,
+// the built-in SkipDirs list is replaced by .git alone.
+func WithIgnoreFiles(names ...string) Option {
+	return func(o *Options) { o.IgnoreFiles = append([]string{}, names...) }
+}
+
+// WithMaxDepth limits the directory rankings to directories at most depth
+// levels below the root. The whole tree is still walked, and everything
+// below the cutoff is counted in the recursive totals of the directory
+// where it was cut off.
+func WithMaxDepth(depth int) Option {
+	return func(o *Options) { o.MaxDepth = depth }
+}
+
+// WithOneFileSystem stops the walk from descending into directories that
+// live on a different device than the scan root.
+func WithOneFileSystem(enabled bool) Option {
+	return func(o *Options) { o.OneFileSystem = enabled }
+}
+
+// WithArchives makes the scanner list the members of tar, tar.gz, tar.xz
+// and zip files. Members are passed to the visitor with paths below the
+// archive's own and summarized in ScanResult.Archives; they don't add to
+// the totals.
+func WithArchives(enabled bool) Option {
+	return func(o *Options) { o.Archives = enabled }
+}
+
+// WithHash makes the workers compute a digest of every regular file with
+// one of HashAlgorithms and set it as FileInfo.Digest. bytesPerSecond caps
+// how fast all workers together read file contents; 0 means no limit.
+func WithHash(algorithm string, bytesPerSecond int64) Option {
+	return func(o *Options) {
+		o.Hash = algorithm
+		o.HashRate = bytesPerSecond
+	}
+}
+
+func WithQuiet(quiet bool) Option {
+	return func(o *Options) { o.Quiet = quiet }
+}
+
+// WithFS makes the scanner read fsys instead of the OS filesystem. Use
+// FromFS to scan an io/fs.FS such as embed.FS or fstest.MapFS, with "." as
+// the root.
+func WithFS(fsys FS) Option {
+	return func(o *Options) { o.FS = fsys }
+}
+
+// WithAnalyzer makes the scanner feed a instead of creating an
+// analyzer.StatisticsCollector. See Configurable, TreeAnalyzer and Recorder
+// for what else a can take.
+func WithAnalyzer(a types.FileAnalyzer) Option {
+	return func(o *Options) { o.Analyzer = a }
+}
+
+func WithProgressWriter(w io.Writer) Option {
+	return func(o *Options) { o.ProgressWriter = w }
+}
+
+// WithVisitor registers fn to receive every file and directory after it has
+// been analyzed. It is called from the worker goroutines, so it must be safe
+// for concurrent use.
+func WithVisitor(fn func(types.FileInfo)) Option {
+	return func(o *Options) { o.Visitor = fn }
+}
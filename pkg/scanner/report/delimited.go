@@ -0,0 +1,93 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"file-counter/pkg/scanner/analyzer"
+	"file-counter/pkg/scanner/types"
+)
+
+const (
+	TableExtensions    = "extensions"
+	TableDirectories   = "directories"
+	TableAllExtensions = "all-extensions"
+)
+
+var Tables = []string{TableExtensions, TableDirectories, TableAllExtensions}
+
+// WriteDelimited writes one of the result tables with a header row. Use ','
+// for CSV and '\t' for TSV; fields containing the delimiter, quotes or
+// newlines are quoted so paths survive a round trip.
+func WriteDelimited(w io.Writer, result *types.ScanResult, comma rune, table string) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = comma
+
+	var rows [][]string
+	switch table {
+	case TableExtensions:
+		rows = extensionRows(result.TopExtensions)
+	case TableAllExtensions:
+		rows = extensionRows(result.Extensions)
+	case TableDirectories:
+		rows = directoryRows(result.TopDirectories)
+	default:
+		return fmt.Errorf("unknown table %q", table)
+	}
+
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+func extensionRows(extensions []types.ExtensionStats) [][]string {
+	rows := [][]string{{
+		"rank", "extension", "category", "count",
+		"total_size_bytes", "disk_usage_bytes", "average_size_bytes", "percentage_of_files",
+	}}
+	for i, ext := range extensions {
+		rows = append(rows, []string{
+			strconv.Itoa(i + 1),
+			ext.Extension,
+			analyzer.GetFileCategory(ext.Extension),
+			strconv.FormatInt(ext.Count, 10),
+			strconv.FormatInt(ext.TotalSize, 10),
+			strconv.FormatInt(ext.DiskUsage, 10),
+			formatFloat(ext.AverageSize),
+			formatFloat(ext.Percentage),
+		})
+	}
+	return rows
+}
+
+func directoryRows(directories []types.DirectoryStats) [][]string {
+	rows := [][]string{{
+		"rank", "path", "file_count", "dir_count",
+		"total_size_bytes", "disk_usage_bytes", "average_size_bytes",
+		"recursive_file_count", "recursive_dir_count", "recursive_size_bytes",
+		"recursive_disk_usage_bytes",
+	}}
+	for i, dir := range directories {
+		rows = append(rows, []string{
+			strconv.Itoa(i + 1),
+			dir.Path,
+			strconv.FormatInt(dir.FileCount, 10),
+			strconv.FormatInt(dir.DirCount, 10),
+			strconv.FormatInt(dir.TotalSize, 10),
+			strconv.FormatInt(dir.DiskUsage, 10),
+			formatFloat(dir.AverageSize),
+			strconv.FormatInt(dir.RecursiveFileCount, 10),
+			strconv.FormatInt(dir.RecursiveDirCount, 10),
+			strconv.FormatInt(dir.RecursiveSize, 10),
+			strconv.FormatInt(dir.RecursiveDiskUsage, 10),
+		})
+	}
+	return rows
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 2, 64)
+}
@@ -0,0 +1,65 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+
+	"file-counter/pkg/scanner/types"
+)
+
+func TestWriteDelimitedRoundTrip(t *testing.T) {
+	const awkward = "/data/a,b/\"quoted\"/two\nlines\tand a tab"
+	result := &types.ScanResult{
+		TopExtensions: []types.ExtensionStats{{Extension: ".go", Count: 3, TotalSize: 300, DiskUsage: 12288, AverageSize: 100, Percentage: 75}},
+		Extensions: []types.ExtensionStats{
+			{Extension: ".go", Count: 3, TotalSize: 300, DiskUsage: 12288, AverageSize: 100, Percentage: 75},
+			{Extension: ".md", Count: 1, TotalSize: 10, DiskUsage: 4096, AverageSize: 10, Percentage: 25},
+		},
+		TopDirectories: []types.DirectoryStats{{Path: awkward, FileCount: 4, TotalSize: 310, DiskUsage: 16384, AverageSize: 77.5}},
+	}
+
+	extensionHeader := []string{"rank", "extension", "category", "count", "total_size_bytes", "disk_usage_bytes", "average_size_bytes", "percentage_of_files"}
+	tests := []struct {
+		table  string
+		header []string
+		rows   int
+		field  string
+	}{
+		{TableExtensions, extensionHeader, 1, ".go"},
+		{TableAllExtensions, extensionHeader, 2, ".go"},
+		{TableDirectories, []string{"rank", "path", "file_count", "dir_count", "total_size_bytes", "disk_usage_bytes", "average_size_bytes", "recursive_file_count", "recursive_dir_count", "recursive_size_bytes", "recursive_disk_usage_bytes"}, 1, awkward},
+	}
+	for _, comma := range []rune{',', '\t'} {
+		for _, tt := range tests {
+			var buf bytes.Buffer
+			if err := WriteDelimited(&buf, result, comma, tt.table); err != nil {
+				t.Fatalf("%s %q: %v", tt.table, comma, err)
+			}
+
+			r := csv.NewReader(&buf)
+			r.Comma = comma
+			records, err := r.ReadAll()
+			if err != nil {
+				t.Fatalf("%s %q: reading back: %v", tt.table, comma, err)
+			}
+			if len(records) != tt.rows+1 {
+				t.Fatalf("%s %q: read %d records, want a header and %d rows", tt.table, comma, len(records), tt.rows)
+			}
+			if !reflect.DeepEqual(records[0], tt.header) {
+				t.Errorf("%s %q: header = %q, want %q", tt.table, comma, records[0], tt.header)
+			}
+			if records[1][1] != tt.field {
+				t.Errorf("%s %q: second field = %q, want %q", tt.table, comma, records[1][1], tt.field)
+			}
+			if len(records[1]) != len(tt.header) {
+				t.Errorf("%s %q: row has %d fields, want %d", tt.table, comma, len(records[1]), len(tt.header))
+			}
+		}
+	}
+
+	if err := WriteDelimited(&bytes.Buffer{}, result, ',', "files"); err == nil {
+		t.Errorf("unknown table written without an error")
+	}
+}
@@ -0,0 +1,134 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"file-counter/pkg/scanner/analyzer"
+	"file-counter/pkg/scanner/diff"
+)
+
+// JSONDiffSource describes one side of a diff: a snapshot file or a live
+// scan, the roots it covers and when it was scanned.
+type JSONDiffSource struct {
+	Source  string    `json:"source"`
+	Roots   []string  `json:"roots"`
+	Scanned time.Time `json:"scanned"`
+}
+
+type JSONDiff struct {
+	SchemaVersion int                   `json:"schema_version"`
+	Old           JSONDiffSource        `json:"old"`
+	New           JSONDiffSource        `json:"new"`
+	SizeMode      string                `json:"size_mode"`
+	RelativePaths bool                  `json:"relative_paths"`
+	OldFiles      int64                 `json:"old_files"`
+	NewFiles      int64                 `json:"new_files"`
+	OldSizeBytes  int64                 `json:"old_size_bytes"`
+	NewSizeBytes  int64                 `json:"new_size_bytes"`
+	DeltaBytes    int64                 `json:"delta_bytes"`
+	Added         []JSONFileChange      `json:"added"`
+	Removed       []JSONFileChange      `json:"removed"`
+	Modified      []JSONFileChange      `json:"modified"`
+	Directories   []JSONDirectoryChange `json:"directories"`
+	Extensions    []JSONExtensionChange `json:"extensions"`
+}
+
+type JSONFileChange struct {
+	Path         string `json:"path"`
+	OldSizeBytes int64  `json:"old_size_bytes"`
+	NewSizeBytes int64  `json:"new_size_bytes"`
+	DeltaBytes   int64  `json:"delta_bytes"`
+}
+
+type JSONDirectoryChange struct {
+	Path         string `json:"path"`
+	OldFiles     int64  `json:"old_files"`
+	NewFiles     int64  `json:"new_files"`
+	OldSizeBytes int64  `json:"old_size_bytes"`
+	NewSizeBytes int64  `json:"new_size_bytes"`
+	DeltaBytes   int64  `json:"delta_bytes"`
+}
+
+type JSONExtensionChange struct {
+	Extension    string `json:"extension"`
+	Category     string `json:"category"`
+	OldCount     int64  `json:"old_count"`
+	NewCount     int64  `json:"new_count"`
+	OldSizeBytes int64  `json:"old_size_bytes"`
+	NewSizeBytes int64  `json:"new_size_bytes"`
+	DeltaBytes   int64  `json:"delta_bytes"`
+}
+
+// NewJSONDiff lists every change in result; the text output only shows the
+// largest ones.
+func NewJSONDiff(result *diff.Result, before, after JSONDiffSource) *JSONDiff {
+	d := &JSONDiff{
+		SchemaVersion: SchemaVersion,
+		Old:           before,
+		New:           after,
+		SizeMode:      result.SizeMode,
+		RelativePaths: result.Relative,
+		OldFiles:      result.OldFiles,
+		NewFiles:      result.NewFiles,
+		OldSizeBytes:  result.OldSize,
+		NewSizeBytes:  result.NewSize,
+		DeltaBytes:    result.Delta(),
+		Added:         newJSONFileChanges(result.Added),
+		Removed:       newJSONFileChanges(result.Removed),
+		Modified:      newJSONFileChanges(result.Modified),
+		Directories:   []JSONDirectoryChange{},
+		Extensions:    []JSONExtensionChange{},
+	}
+	if d.Old.Roots == nil {
+		d.Old.Roots = []string{}
+	}
+	if d.New.Roots == nil {
+		d.New.Roots = []string{}
+	}
+
+	for _, c := range result.Directories {
+		d.Directories = append(d.Directories, JSONDirectoryChange{
+			Path:         c.Path,
+			OldFiles:     c.OldFiles,
+			NewFiles:     c.NewFiles,
+			OldSizeBytes: c.OldSize,
+			NewSizeBytes: c.NewSize,
+			DeltaBytes:   c.Delta(),
+		})
+	}
+
+	for _, c := range result.Extensions {
+		d.Extensions = append(d.Extensions, JSONExtensionChange{
+			Extension:    c.Extension,
+			Category:     analyzer.GetFileCategory(c.Extension),
+			OldCount:     c.OldCount,
+			NewCount:     c.NewCount,
+			OldSizeBytes: c.OldSize,
+			NewSizeBytes: c.NewSize,
+			DeltaBytes:   c.Delta(),
+		})
+	}
+
+	return d
+}
+
+func WriteDiffJSON(w io.Writer, result *diff.Result, before, after JSONDiffSource) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(NewJSONDiff(result, before, after))
+}
+
+func newJSONFileChanges(changes []diff.FileChange) []JSONFileChange {
+	list := []JSONFileChange{}
+	for _, c := range changes {
+		list = append(list, JSONFileChange{
+			Path:         c.Path,
+			OldSizeBytes: c.OldSize,
+			NewSizeBytes: c.NewSize,
+			DeltaBytes:   c.Delta(),
+		})
+	}
+	return list
+}
@@ -0,0 +1,315 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"file-counter/pkg/scanner/analyzer"
+	"file-counter/pkg/scanner/types"
+)
+
+// SchemaVersion is bumped whenever a field in the JSON report is renamed or
+// removed. Adding fields does not change it.
+const SchemaVersion = 1
+
+type JSONReport struct {
+	SchemaVersion        int             `json:"schema_version"`
+	ScannedPath          string          `json:"scanned_path"`
+	Roots                []JSONRoot      `json:"roots"`
+	TotalFiles           int64           `json:"total_files"`
+	TotalDirectories     int64           `json:"total_directories"`
+	TotalSizeBytes       int64           `json:"total_size_bytes"`
+	TotalDiskUsageBytes  int64           `json:"total_disk_usage_bytes"`
+	SizeMode             string          `json:"size_mode"`
+	TotalErrors          int64           `json:"total_errors"`
+	ScanDurationSeconds  float64         `json:"scan_duration_seconds"`
+	AverageFileSizeBytes float64         `json:"average_file_size_bytes"`
+	FilesPerSecond       float64         `json:"files_per_second"`
+	BytesPerSecond       float64         `json:"bytes_per_second"`
+	LargestFile          *JSONFile       `json:"largest_file,omitempty"`
+	SmallestFile         *JSONFile       `json:"smallest_file,omitempty"`
+	OldestFile           *JSONFile       `json:"oldest_file,omitempty"`
+	NewestFile           *JSONFile       `json:"newest_file,omitempty"`
+	HardLinks            JSONHardLinks   `json:"hard_links"`
+	SkippedMountPoints   []string        `json:"skipped_mount_points"`
+	Ignored              JSONIgnored     `json:"ignored"`
+	Skipped              []JSONSkipped   `json:"skipped"`
+	Symlinks             JSONSymlinks    `json:"symlinks"`
+	BrokenLinks          []JSONBroken    `json:"broken_links"`
+	Archives             []JSONArchive   `json:"archives"`
+	Duplicates           *JSONDuplicates `json:"duplicates,omitempty"`
+	TopExtensions        []JSONExtension `json:"top_extensions"`
+	TopDirectories       []JSONDirectory `json:"top_directories"`
+	MaxDepth             int             `json:"max_depth,omitempty"`
+	DepthStats           []JSONDepth     `json:"depth_stats"`
+}
+
+type JSONRoot struct {
+	Path           string `json:"path"`
+	Files          int64  `json:"files"`
+	Directories    int64  `json:"directories"`
+	SizeBytes      int64  `json:"size_bytes"`
+	DiskUsageBytes int64  `json:"disk_usage_bytes"`
+	CoveredBy      string `json:"covered_by,omitempty"`
+}
+
+type JSONFile struct {
+	Path           string    `json:"path"`
+	SizeBytes      int64     `json:"size_bytes"`
+	DiskUsageBytes int64     `json:"disk_usage_bytes"`
+	ModTime        time.Time `json:"mod_time"`
+}
+
+type JSONHardLinks struct {
+	LinkedFiles                int64 `json:"linked_files"`
+	UniqueInodes               int64 `json:"unique_inodes"`
+	DuplicateLinks             int64 `json:"duplicate_links"`
+	DeduplicatedBytes          int64 `json:"deduplicated_bytes"`
+	DeduplicatedDiskUsageBytes int64 `json:"deduplicated_disk_usage_bytes"`
+}
+
+type JSONIgnored struct {
+	Files       int64 `json:"files"`
+	Directories int64 `json:"directories"`
+	FileBytes   int64 `json:"file_bytes"`
+}
+
+type JSONSkipped struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+	FSType string `json:"fstype,omitempty"`
+	IsDir  bool   `json:"is_dir"`
+}
+
+type JSONSymlinks struct {
+	Links    int64 `json:"links"`
+	Bytes    int64 `json:"bytes"`
+	Followed int64 `json:"followed"`
+}
+
+type JSONBroken struct {
+	Path   string `json:"path"`
+	Target string `json:"target"`
+	Reason string `json:"reason"`
+}
+
+type JSONArchive struct {
+	Path                  string `json:"path"`
+	Format                string `json:"format"`
+	Files                 int64  `json:"files"`
+	Directories           int64  `json:"directories"`
+	SizeBytes             int64  `json:"size_bytes"`
+	UncompressedSizeBytes int64  `json:"uncompressed_size_bytes"`
+	Error                 string `json:"error,omitempty"`
+}
+
+type JSONDuplicates struct {
+	Sets             []JSONDuplicateSet `json:"sets"`
+	Files            int64              `json:"files"`
+	WastedBytes      int64              `json:"wasted_bytes"`
+	HardLinksSkipped int64              `json:"hard_links_skipped"`
+	Errors           int64              `json:"errors"`
+}
+
+type JSONDuplicateSet struct {
+	SizeBytes   int64    `json:"size_bytes"`
+	SHA256      string   `json:"sha256"`
+	WastedBytes int64    `json:"wasted_bytes"`
+	Paths       []string `json:"paths"`
+}
+
+type JSONExtension struct {
+	Extension         string  `json:"extension"`
+	Category          string  `json:"category"`
+	Count             int64   `json:"count"`
+	TotalSizeBytes    int64   `json:"total_size_bytes"`
+	DiskUsageBytes    int64   `json:"disk_usage_bytes"`
+	AverageSizeBytes  float64 `json:"average_size_bytes"`
+	PercentageOfFiles float64 `json:"percentage_of_files"`
+}
+
+type JSONDirectory struct {
+	Path                    string  `json:"path"`
+	FileCount               int64   `json:"file_count"`
+	DirCount                int64   `json:"dir_count"`
+	TotalSizeBytes          int64   `json:"total_size_bytes"`
+	DiskUsageBytes          int64   `json:"disk_usage_bytes"`
+	AverageSizeBytes        float64 `json:"average_size_bytes"`
+	RecursiveFileCount      int64   `json:"recursive_file_count"`
+	RecursiveDirCount       int64   `json:"recursive_dir_count"`
+	RecursiveSizeBytes      int64   `json:"recursive_size_bytes"`
+	RecursiveDiskUsageBytes int64   `json:"recursive_disk_usage_bytes"`
+}
+
+type JSONDepth struct {
+	Depth int   `json:"depth"`
+	Files int64 `json:"files"`
+}
+
+func NewJSONReport(result *types.ScanResult, scanPath string) *JSONReport {
+	r := &JSONReport{
+		SchemaVersion:        SchemaVersion,
+		ScannedPath:          scanPath,
+		TotalFiles:           result.TotalFiles,
+		TotalDirectories:     result.TotalDirs,
+		TotalSizeBytes:       result.TotalSize,
+		TotalDiskUsageBytes:  result.TotalDiskUsage,
+		SizeMode:             result.SizeMode,
+		TotalErrors:          result.TotalErrors,
+		ScanDurationSeconds:  result.ScanDuration.Seconds(),
+		AverageFileSizeBytes: result.AverageFileSize,
+		FilesPerSecond:       result.FilesPerSecond,
+		BytesPerSecond:       result.BytesPerSecond,
+		HardLinks: JSONHardLinks{
+			LinkedFiles:                result.HardLinks.LinkedFiles,
+			UniqueInodes:               result.HardLinks.UniqueInodes,
+			DuplicateLinks:             result.HardLinks.DuplicateLinks,
+			DeduplicatedBytes:          result.HardLinks.DeduplicatedBytes,
+			DeduplicatedDiskUsageBytes: result.HardLinks.DeduplicatedDiskUsage,
+		},
+		SkippedMountPoints: append([]string{}, result.SkippedMounts...),
+		Ignored: JSONIgnored{
+			Files:       result.Ignored.Files,
+			Directories: result.Ignored.Dirs,
+			FileBytes:   result.Ignored.Bytes,
+		},
+		Symlinks: JSONSymlinks{
+			Links:    result.Symlinks.Links,
+			Bytes:    result.Symlinks.Bytes,
+			Followed: result.Symlinks.Followed,
+		},
+		BrokenLinks:    []JSONBroken{},
+		Archives:       []JSONArchive{},
+		TopExtensions:  []JSONExtension{},
+		TopDirectories: []JSONDirectory{},
+		MaxDepth:       result.MaxDepth,
+		DepthStats:     []JSONDepth{},
+	}
+
+	r.Roots = []JSONRoot{}
+	for _, root := range result.Roots {
+		r.Roots = append(r.Roots, JSONRoot{
+			Path:           root.Path,
+			Files:          root.Files,
+			Directories:    root.Dirs,
+			SizeBytes:      root.Size,
+			DiskUsageBytes: root.DiskUsage,
+			CoveredBy:      root.CoveredBy,
+		})
+	}
+
+	r.Skipped = []JSONSkipped{}
+	for _, skipped := range result.Skipped {
+		r.Skipped = append(r.Skipped, JSONSkipped{
+			Path:   skipped.Path,
+			Reason: skipped.Reason,
+			FSType: skipped.FSType,
+			IsDir:  skipped.IsDir,
+		})
+	}
+
+	for _, link := range result.BrokenLinks {
+		r.BrokenLinks = append(r.BrokenLinks, JSONBroken{
+			Path:   link.Path,
+			Target: link.Target,
+			Reason: link.Reason,
+		})
+	}
+
+	for _, a := range result.Archives {
+		r.Archives = append(r.Archives, JSONArchive{
+			Path:                  a.Path,
+			Format:                a.Format,
+			Files:                 a.Files,
+			Directories:           a.Dirs,
+			SizeBytes:             a.Size,
+			UncompressedSizeBytes: a.UncompressedSize,
+			Error:                 a.Error,
+		})
+	}
+
+	if d := result.Duplicates; d != nil {
+		r.Duplicates = &JSONDuplicates{
+			Sets:             []JSONDuplicateSet{},
+			Files:            d.Files,
+			WastedBytes:      d.WastedBytes,
+			HardLinksSkipped: d.HardLinksSkipped,
+			Errors:           d.Errors,
+		}
+		for _, set := range d.Sets {
+			r.Duplicates.Sets = append(r.Duplicates.Sets, JSONDuplicateSet{
+				SizeBytes:   set.Size,
+				SHA256:      set.SHA256,
+				WastedBytes: set.WastedBytes,
+				Paths:       set.Paths,
+			})
+		}
+	}
+
+	r.LargestFile = newJSONFile(result.LargestFile)
+	r.SmallestFile = newJSONFile(result.SmallestFile)
+	r.OldestFile = newJSONFile(result.OldestFile)
+	r.NewestFile = newJSONFile(result.NewestFile)
+
+	for _, ext := range result.TopExtensions {
+		r.TopExtensions = append(r.TopExtensions, newJSONExtension(ext))
+	}
+
+	for _, dir := range result.TopDirectories {
+		r.TopDirectories = append(r.TopDirectories, JSONDirectory{
+			Path:                    dir.Path,
+			FileCount:               dir.FileCount,
+			DirCount:                dir.DirCount,
+			TotalSizeBytes:          dir.TotalSize,
+			DiskUsageBytes:          dir.DiskUsage,
+			AverageSizeBytes:        dir.AverageSize,
+			RecursiveFileCount:      dir.RecursiveFileCount,
+			RecursiveDirCount:       dir.RecursiveDirCount,
+			RecursiveSizeBytes:      dir.RecursiveSize,
+			RecursiveDiskUsageBytes: dir.RecursiveDiskUsage,
+		})
+	}
+
+	for depth, files := range result.DepthStats {
+		r.DepthStats = append(r.DepthStats, JSONDepth{Depth: depth, Files: files})
+	}
+	sort.Slice(r.DepthStats, func(i, j int) bool {
+		return r.DepthStats[i].Depth < r.DepthStats[j].Depth
+	})
+
+	return r
+}
+
+func WriteJSON(w io.Writer, result *types.ScanResult, scanPath string) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(NewJSONReport(result, scanPath))
+}
+
+// newJSONFile returns nil for an extreme that was never set, such as the
+// largest file when every file is empty.
+func newJSONFile(info types.FileInfo) *JSONFile {
+	if info.Path == "" {
+		return nil
+	}
+	return &JSONFile{
+		Path:           info.Path,
+		SizeBytes:      info.Size,
+		DiskUsageBytes: info.DiskUsage,
+		ModTime:        info.ModTime,
+	}
+}
+
+func newJSONExtension(ext types.ExtensionStats) JSONExtension {
+	return JSONExtension{
+		Extension:         ext.Extension,
+		Category:          analyzer.GetFileCategory(ext.Extension),
+		Count:             ext.Count,
+		TotalSizeBytes:    ext.TotalSize,
+		DiskUsageBytes:    ext.DiskUsage,
+		AverageSizeBytes:  ext.AverageSize,
+		PercentageOfFiles: ext.Percentage,
+	}
+}
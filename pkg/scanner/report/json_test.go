@@ -0,0 +1,31 @@
+package report
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"file-counter/pkg/scanner/types"
+)
+
+func TestJSONReportLeavesOutUnsetExtremes(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	empty := types.FileInfo{Path: "/r/empty", ModTime: modTime}
+
+	// Only empty files were scanned, so the largest and smallest file
+	// still hold the collector's starting values.
+	result := &types.ScanResult{
+		TotalFiles:   2,
+		SmallestFile: types.FileInfo{Size: math.MaxInt64, DiskUsage: math.MaxInt64},
+		OldestFile:   empty,
+		NewestFile:   empty,
+	}
+	r := NewJSONReport(result, "/r")
+
+	if r.LargestFile != nil || r.SmallestFile != nil {
+		t.Errorf("LargestFile, SmallestFile = %+v, %+v, want both left out", r.LargestFile, r.SmallestFile)
+	}
+	if r.OldestFile == nil || r.OldestFile.Path != "/r/empty" || r.NewestFile == nil || r.NewestFile.Path != "/r/empty" {
+		t.Errorf("OldestFile, NewestFile = %+v, %+v, want /r/empty", r.OldestFile, r.NewestFile)
+	}
+}
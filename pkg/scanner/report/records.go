@@ -0,0 +1,163 @@
+package report
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"file-counter/pkg/scanner/analyzer"
+	"file-counter/pkg/scanner/types"
+)
+
+type Record struct {
+	Path      string    `json:"path"`
+	Type      string    `json:"type"`
+	SizeBytes int64     `json:"size_bytes"`
+	DiskUsage int64     `json:"disk_usage_bytes"`
+	ModTime   time.Time `json:"mod_time"`
+	Extension string    `json:"extension,omitempty"`
+	Category  string    `json:"category"`
+	Mode      string    `json:"mode"`
+	Uid       uint32    `json:"uid"`
+	Gid       uint32    `json:"gid"`
+	Owner     string    `json:"owner,omitempty"`
+	Group     string    `json:"group,omitempty"`
+	Inode     uint64    `json:"inode"`
+	Device    uint64    `json:"device"`
+	Links     uint64    `json:"links"`
+	Depth     int       `json:"depth"`
+	Target    string    `json:"link_target,omitempty"`
+	Archive   string    `json:"archive,omitempty"`
+	Digest    string    `json:"digest,omitempty"`
+	// Compressed is only set for archive members whose compressed size
+	// is known.
+	Compressed *int64 `json:"compressed_size_bytes,omitempty"`
+}
+
+// RecordWriter writes one JSON object per line for every entry passed to
+// Write.
+type RecordWriter struct {
+	mu      sync.Mutex
+	buf     *bufio.Writer
+	encoder *json.Encoder
+	err     error
+
+	users  map[uint32]string
+	groups map[uint32]string
+}
+
+func NewRecordWriter(w io.Writer) *RecordWriter {
+	buf := bufio.NewWriter(w)
+	return &RecordWriter{
+		buf:     buf,
+		encoder: json.NewEncoder(buf),
+		users:   make(map[uint32]string),
+		groups:  make(map[uint32]string),
+	}
+}
+
+func (rw *RecordWriter) Write(info types.FileInfo) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if rw.err != nil {
+		return
+	}
+	rw.err = rw.encoder.Encode(rw.newRecord(info))
+}
+
+// Flush writes any buffered records and returns the first error seen.
+func (rw *RecordWriter) Flush() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	if rw.err != nil {
+		return rw.err
+	}
+	rw.err = rw.buf.Flush()
+	return rw.err
+}
+
+func (rw *RecordWriter) newRecord(info types.FileInfo) Record {
+	record := Record{
+		Path:      info.Path,
+		Type:      fileType(info),
+		SizeBytes: info.Size,
+		DiskUsage: info.DiskUsage,
+		ModTime:   info.ModTime,
+		Extension: info.Extension,
+		Mode:      info.Mode.String(),
+		Uid:       info.Uid,
+		Gid:       info.Gid,
+		Inode:     info.Inode,
+		Device:    info.Device,
+		Links:     info.Links,
+		Depth:     info.Depth,
+		Target:    info.LinkTarget,
+		Archive:   info.Archive,
+		Digest:    info.Digest,
+	}
+	if info.Archive != "" {
+		// Archive owners are names from wherever the archive was made,
+		// not users of this system.
+		record.Owner = info.Owner
+		record.Group = info.Group
+		if info.CompressedSize >= 0 {
+			compressed := info.CompressedSize
+			record.Compressed = &compressed
+		}
+	} else {
+		record.Owner = rw.lookupUser(info.Uid)
+		record.Group = rw.lookupGroup(info.Gid)
+	}
+	switch {
+	case info.IsDir:
+		record.Category = "Directory"
+	case info.IsSymlink():
+		record.Category = "Link"
+	default:
+		record.Category = analyzer.GetFileCategory(filepath.Base(info.Path))
+	}
+	return record
+}
+
+func fileType(info types.FileInfo) string {
+	switch {
+	case info.IsDir:
+		return "dir"
+	case info.Mode&fs.ModeSymlink != 0:
+		return "symlink"
+	case info.Mode.IsRegular():
+		return "file"
+	default:
+		return "other"
+	}
+}
+
+func (rw *RecordWriter) lookupUser(uid uint32) string {
+	name, ok := rw.users[uid]
+	if !ok {
+		if u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10)); err == nil {
+			name = u.Username
+		}
+		rw.users[uid] = name
+	}
+	return name
+}
+
+func (rw *RecordWriter) lookupGroup(gid uint32) string {
+	name, ok := rw.groups[gid]
+	if !ok {
+		if g, err := user.LookupGroupId(strconv.FormatUint(uint64(gid), 10)); err == nil {
+			name = g.Name
+		}
+		rw.groups[gid] = name
+	}
+	return name
+}
@@ -0,0 +1,60 @@
+package report
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"sync"
+
+	"file-counter/pkg/scanner/types"
+)
+
+// SumsWriter streams one "digest  path" line per hashed file, the format
+// that sha256sum -c, sha1sum -c, b2sum -c and xxhsum -c read back.
+type SumsWriter struct {
+	mu  sync.Mutex
+	buf *bufio.Writer
+	err error
+}
+
+func NewSumsWriter(w io.Writer) *SumsWriter {
+	return &SumsWriter{buf: bufio.NewWriter(w)}
+}
+
+// Write adds a line for info if it has a digest, and ignores it otherwise.
+func (sw *SumsWriter) Write(info types.FileInfo) {
+	if info.Digest == "" {
+		return
+	}
+
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if sw.err != nil {
+		return
+	}
+	_, sw.err = io.WriteString(sw.buf, sumLine(info.Digest, info.Path))
+}
+
+// Flush writes any buffered lines and returns the first error seen.
+func (sw *SumsWriter) Flush() error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if sw.err != nil {
+		return sw.err
+	}
+	sw.err = sw.buf.Flush()
+	return sw.err
+}
+
+// sumLine formats a line the way coreutils does: names containing a
+// backslash or a line break are escaped, and the line starts with a
+// backslash to say so.
+func sumLine(digest, path string) string {
+	if !strings.ContainsAny(path, "\\\n\r") {
+		return digest + "  " + path + "\n"
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`).Replace(path)
+	return `\` + digest + "  " + escaped + "\n"
+}
@@ -0,0 +1,139 @@
+package scanner
+
+import (
+	"path/filepath"
+	"strings"
+
+	"file-counter/pkg/scanner/types"
+)
+
+// rules decides which paths the walker leaves out. Include patterns win
+// over both user excludes and the built-in skip lists, so a single
+// directory such as node_modules can be brought back without turning the
+// defaults off entirely.
+type rules struct {
+	excludes  []string
+	includes  []string
+	skipDirs  map[string]bool
+	skipPaths []string
+	skipTypes map[string]bool
+	mounts    map[string]Mount
+}
+
+func newRules(opts Options) *rules {
+	r := &rules{
+		excludes:  opts.Excludes,
+		includes:  opts.Includes,
+		skipDirs:  make(map[string]bool),
+		skipPaths: opts.SkipPaths,
+		skipTypes: make(map[string]bool),
+	}
+	switch {
+	case opts.NoDefaultExcludes:
+	case len(opts.IgnoreFiles) > 0:
+		// Ignore files describe what a repository doesn't track far
+		// better than a list of names, but git never lists its own
+		// directory in them.
+		r.skipDirs[".git"] = true
+	default:
+		for _, name := range opts.SkipDirs {
+			r.skipDirs[name] = true
+		}
+	}
+
+	for _, fstype := range opts.SkipFSTypes {
+		r.skipTypes[fstype] = true
+	}
+	if !opts.NoDefaultExcludes {
+		for _, fstype := range DefaultSkipFSTypes {
+			r.skipTypes[fstype] = true
+		}
+	}
+
+	if len(r.skipTypes) > 0 {
+		if mounts, err := ReadMounts(); err == nil && len(mounts) > 0 {
+			r.mounts = make(map[string]Mount, len(mounts))
+			for _, m := range mounts {
+				// Later entries are mounted on top of earlier ones.
+				r.mounts[m.MountPoint] = m
+			}
+		}
+	}
+	if r.mounts == nil && !opts.NoDefaultExcludes {
+		r.skipPaths = append(append([]string{}, r.skipPaths...), DefaultSkipPaths...)
+	}
+	return r
+}
+
+// skip reports why path, found below root, should be left out, or "" if it
+// should be scanned. absPath is path made absolute, for the mount table and
+// the system prefixes. fstype is set when a mount point is skipped.
+func (r *rules) skip(root, path, absPath string, isDir bool) (reason, fstype string) {
+	if matchAny(r.includes, root, path, absPath) {
+		return "", ""
+	}
+	if reason, fstype := r.systemSkip(absPath, isDir); reason != "" {
+		return reason, fstype
+	}
+	if isDir && r.skipDirs[filepath.Base(path)] {
+		return types.SkipBuiltinRule, ""
+	}
+	if matchAny(r.excludes, root, path, absPath) {
+		return types.SkipUserExclude, ""
+	}
+	return "", ""
+}
+
+// systemSkip checks a directory against the mount table and any path
+// against the skipped prefixes.
+func (r *rules) systemSkip(absPath string, isDir bool) (reason, fstype string) {
+	if isDir {
+		if m, ok := r.mounts[absPath]; ok {
+			class := FSClass(m.FSType)
+			if r.skipTypes[m.FSType] || r.skipTypes[class] {
+				if class == FSClassPseudo {
+					return types.SkipPseudoFS, m.FSType
+				}
+				return types.SkipFSType, m.FSType
+			}
+		}
+	}
+	for _, skipPath := range r.skipPaths {
+		if absPath == skipPath || strings.HasPrefix(absPath, skipPath+"/") {
+			return types.SkipPseudoFS, ""
+		}
+	}
+	return "", ""
+}
+
+// matchAny matches glob patterns the way most tools do: a pattern without a
+// separator is compared with the base name, an absolute pattern with the
+// absolute path and any other pattern with the path relative to the scan
+// root.
+func matchAny(patterns []string, root, path, absPath string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+
+	name := filepath.Base(path)
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = path
+	}
+
+	for _, pattern := range patterns {
+		var target string
+		switch {
+		case !strings.ContainsRune(pattern, filepath.Separator):
+			target = name
+		case filepath.IsAbs(pattern):
+			target = absPath
+		default:
+			target = rel
+		}
+		if matched, _ := filepath.Match(pattern, target); matched {
+			return true
+		}
+	}
+	return false
+}
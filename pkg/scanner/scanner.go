@@ -3,15 +3,17 @@ package scanner
 import (
 	"context"
 	"fmt"
-	"os"
+	"hash"
+	"io/fs"
+	"path"
 	"path/filepath"
-	"runtime"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"file-counter/pkg/scanner/analyzer"
+	"file-counter/pkg/scanner/archive"
 	"file-counter/pkg/scanner/types"
 )
 
@@ -29,7 +31,14 @@ type Scanner struct {
 	mu             sync.Mutex
 	lastError      string
 	currentPath    string
-	analyzer       *analyzer.StatisticsCollector
+	analyzer       types.FileAnalyzer
+	tree           TreeAnalyzer
+	recorder       Recorder
+	opts           Options
+	rules          *rules
+	fs             FS
+	newHash        func() hash.Hash
+	hashLimiter    *rateLimiter
 }
 type ScanResult struct {
 	TotalFiles     int64
@@ -41,128 +50,262 @@ type ScanResult struct {
 	FilesPerSecond float64
 }
 
-func NewScanner() *Scanner {
+func NewScanner(opts ...Option) *Scanner {
+	options := DefaultOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return NewScannerWithOptions(options)
+}
+
+// NewScannerWithOptions builds a scanner from opts. Zero-valued fields fall
+// back to DefaultOptions; pass an empty, non-nil SkipDirs to disable the
+// built-in directory list.
+func NewScannerWithOptions(opts Options) *Scanner {
 	ctx, cancel := context.WithCancel(context.Background())
 
+	defaults := DefaultOptions()
+	if opts.Workers <= 0 {
+		opts.Workers = defaults.Workers
+	}
+	if opts.Walkers <= 0 {
+		opts.Walkers = opts.Workers
+	}
+	if opts.TopN <= 0 {
+		opts.TopN = defaults.TopN
+	}
+	if opts.ProgressInterval <= 0 {
+		opts.ProgressInterval = defaults.ProgressInterval
+	}
+	if opts.SkipDirs == nil {
+		opts.SkipDirs = defaults.SkipDirs
+	}
+	if opts.SizeMode == "" {
+		opts.SizeMode = defaults.SizeMode
+	}
+	if opts.Symlinks == "" {
+		opts.Symlinks = defaults.Symlinks
+	}
+	if opts.DirectorySort == "" {
+		opts.DirectorySort = defaults.DirectorySort
+	}
+	if opts.ProgressWriter == nil {
+		opts.ProgressWriter = defaults.ProgressWriter
+	}
+	if opts.FS == nil {
+		opts.FS = defaults.FS
+	}
+
+	collector := opts.Analyzer
+	if collector == nil {
+		collector = analyzer.NewStatisticsCollector()
+	}
+	if c, ok := collector.(Configurable); ok {
+		c.SetTopN(opts.TopN)
+		c.SetDirectorySort(opts.DirectorySort)
+		c.SetSizeMode(opts.SizeMode)
+		c.SetMaxDepth(opts.MaxDepth)
+	}
+	tree, ok := collector.(TreeAnalyzer)
+	if !ok {
+		tree = fileTree{collector}
+	}
+	recorder, ok := collector.(Recorder)
+	if !ok {
+		recorder = nopRecorder{}
+	}
+
 	return &Scanner{
 		startTime:      time.Now(),
 		ctx:            ctx,
 		cancel:         cancel,
-		workerCount:    runtime.GOMAXPROCS(0) * 2,
-		progressTicker: time.NewTicker(50 * time.Millisecond),
-		analyzer:       analyzer.NewStatisticsCollector(),
+		workerCount:    opts.Workers,
+		progressTicker: time.NewTicker(opts.ProgressInterval),
+		analyzer:       collector,
+		tree:           tree,
+		recorder:       recorder,
+		opts:           opts,
+		rules:          newRules(opts),
+		fs:             opts.FS,
+		newHash:        hashes[opts.Hash],
+		hashLimiter:    newRateLimiter(opts.HashRate),
 	}
 }
-func (s *Scanner) Start(rootPath string) *types.ScanResult {
-	go s.displayProgress()
 
-	pathChan := make(chan string, 1000)
+// Start scans every root and returns the combined result. Roots inside
+// another root are listed in the result but not scanned again.
+func (s *Scanner) Start(rootPaths ...string) *types.ScanResult {
+	roots, covered := dedupRoots(rootPaths)
+	for _, root := range roots {
+		s.tree.AddRoot(root)
+	}
+	for _, root := range covered {
+		s.tree.AddCoveredRoot(root.Path, root.CoveredBy)
+	}
+
+	return s.run(func(entries chan<- entry) {
+		for _, root := range roots {
+			if s.ctx.Err() != nil {
+				return
+			}
+			s.walkDirectory(root, entries)
+		}
+	})
+}
+
+// run starts the workers, feeds them everything produce sends and collects
+// the results once produce has returned and the workers are done.
+func (s *Scanner) run(produce func(entries chan<- entry)) *types.ScanResult {
+	if !s.opts.Quiet {
+		go s.displayProgress()
+	}
+
+	entries := make(chan entry, 1000)
 	var wg sync.WaitGroup
 	for i := 0; i < s.workerCount; i++ {
 		wg.Add(1)
-		go s.worker(pathChan, &wg)
+		go s.worker(entries, &wg)
 	}
 
 	go func() {
-		defer close(pathChan)
-		s.walkDirectory(rootPath, pathChan)
+		defer close(entries)
+		produce(entries)
 	}()
 
 	wg.Wait()
 	s.progressTicker.Stop()
 
-	result := s.analyzer.GetResults()
+	return s.analyzer.GetResults()
+}
 
-	if result.TotalErrors == 0 {
-		result.TotalErrors = atomic.LoadInt64(&s.errorCount)
+// dedupRoots cleans the roots and drops any that lie inside, or repeat,
+// another one, so nothing is counted twice. Each dropped root is returned
+// in covered along with the outermost root that includes it.
+func dedupRoots(paths []string) (roots []string, covered []types.RootStats) {
+	abs := make([]string, len(paths))
+	for i, path := range paths {
+		abs[i] = filepath.Clean(path)
+		if a, err := filepath.Abs(path); err == nil {
+			abs[i] = a
+		}
 	}
 
-	return result
+	for i, path := range paths {
+		outer := -1
+		for j := range paths {
+			// Of two identical roots the first one is kept.
+			if i == j || (abs[i] == abs[j] && j > i) || !within(abs[i], abs[j]) {
+				continue
+			}
+			if outer < 0 || len(abs[j]) < len(abs[outer]) {
+				outer = j
+			}
+		}
+		if outer < 0 {
+			roots = append(roots, filepath.Clean(path))
+		} else {
+			covered = append(covered, types.RootStats{Path: filepath.Clean(path), CoveredBy: filepath.Clean(paths[outer])})
+		}
+	}
+	return roots, covered
 }
+
+// within reports whether path is dir or lies below it.
+func within(path, dir string) bool {
+	if path == dir {
+		return true
+	}
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, dir)
+}
+
 func (s *Scanner) Stop() {
 	s.cancel()
 }
-func (s *Scanner) worker(pathChan <-chan string, wg *sync.WaitGroup) {
+func (s *Scanner) worker(entries <-chan entry, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for {
 		select {
-		case path, ok := <-pathChan:
+		case e, ok := <-entries:
 			if !ok {
 				return
 			}
-			s.ProcessPath(path)
+			s.processEntry(e)
 		case <-s.ctx.Done():
 			return
 		}
 	}
 }
-func (s *Scanner) walkDirectory(root string, pathChan chan<- string) {
-	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		select {
-		case <-s.ctx.Done():
-			return filepath.SkipDir
-		default:
-		}
 
-		if err != nil {
-			atomic.AddInt64(&s.errorCount, 1)
-			s.setLastError(fmt.Sprintf("Error accessing %s: %v", path, err))
-			return nil
-		}
-
-		if info.IsDir() {
-			dirName := filepath.Base(path)
-			switch dirName {
-			case ".git", "node_modules", ".npm", "venv", ".venv", "env", ".env",
-				"target", "build", "dist", ".next", ".nuxt", "coverage", ".coverage",
-				".vscode", ".idea", "__pycache__", ".pytest_cache", "site-packages",
-				"vendor", ".vendor", "cache", ".cache":
-				return filepath.SkipDir
-			}
-		}
-
-		s.setCurrentPath(path)
-
-		select {
-		case pathChan <- path:
-		case <-s.ctx.Done():
-			return filepath.SkipDir
-		}
-
-		return nil
-	})
-}
+// ProcessPath stats a single path and records it.
 func (s *Scanner) ProcessPath(path string) {
-	info, err := os.Lstat(path)
+	info, err := s.lstat(path)
 	if err != nil {
-		atomic.AddInt64(&s.errorCount, 1)
-		s.analyzer.IncrementError()
-		s.setLastError(fmt.Sprintf("Error getting info for %s: %v", path, err))
+		s.statError(path, err)
 		return
 	}
+	s.processEntry(entry{path: path, info: info})
+}
 
-	ext := ""
-	if !info.IsDir() {
-		if idx := strings.LastIndex(info.Name(), "."); idx > 0 {
-			ext = strings.ToLower(info.Name()[idx:])
+// processEntry records an entry from the walker, stat'ing it only if the
+// walker didn't already.
+func (s *Scanner) processEntry(e entry) {
+	info, err := s.entryInfo(e)
+	if err != nil {
+		s.statError(e.path, err)
+		return
+	}
+	path := e.path
+
+	// The walker resolves links itself, but paths from a list arrive as
+	// they are.
+	if info.Mode()&fs.ModeSymlink != 0 && s.opts.Symlinks == types.SymlinkFollow && !e.followed && e.linkErr == nil {
+		depth := e.depth
+		if e = s.follow(path, e.dirent); e.linkErr == nil {
+			info = e.info
 		}
+		e.depth = depth
 	}
 
-	fileInfo := types.FileInfo{
-		Path:      path,
-		Size:      info.Size(),
-		ModTime:   info.ModTime(),
-		IsDir:     info.IsDir(),
-		Extension: ext,
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if s.opts.Symlinks != types.SymlinkSkip {
+			s.processSymlink(e, info)
+		}
+		return
+	}
+
+	fileInfo := newFileInfo(path, info)
+	fileInfo.Depth = e.depth
+	if e.followed {
+		fileInfo.LinkTarget, _ = s.readLink(path)
+	}
+	if s.newHash != nil && info.Mode().IsRegular() {
+		digest, err := s.hashFile(path)
+		if err != nil && s.ctx.Err() == nil {
+			s.addError(fmt.Sprintf("Error hashing %s: %v", path, err))
+		}
+		fileInfo.Digest = digest
 	}
 
 	if info.IsDir() {
-		s.analyzer.AnalyzeDirectory(path, fileInfo)
+		s.tree.AnalyzeDirectory(path, fileInfo)
 	} else {
 		s.analyzer.AnalyzeFile(path, fileInfo)
 	}
 
+	if s.opts.Visitor != nil {
+		s.opts.Visitor(fileInfo)
+	}
+
+	if s.opts.Archives && info.Mode().IsRegular() {
+		if format := archive.Format(info.Name()); format != "" {
+			s.scanArchive(fileInfo, format)
+		}
+	}
+
 	if info.IsDir() {
 		atomic.AddInt64(&s.dirCount, 1)
 	} else {
@@ -170,22 +313,126 @@ func (s *Scanner) ProcessPath(path string) {
 		atomic.AddInt64(&s.bytesScanned, info.Size())
 	}
 
-	if s.ShouldSkipPath(path) {
-		atomic.AddInt64(&s.skippedCount, 1)
+}
+
+// processSymlink records a link that isn't followed, and reports it as
+// broken if its target can't be reached.
+func (s *Scanner) processSymlink(e entry, info fs.FileInfo) {
+	fileInfo := newFileInfo(e.path, info)
+	fileInfo.Depth = e.depth
+	fileInfo.LinkTarget, _ = s.readLink(e.path)
+
+	err := e.linkErr
+	if err == nil {
+		_, err = s.stat(e.path)
+	}
+	if err != nil {
+		if pathErr, ok := err.(*fs.PathError); ok {
+			err = pathErr.Err
+		}
+		s.recorder.AddBrokenLink(types.BrokenLink{Path: e.path, Target: fileInfo.LinkTarget, Reason: err.Error()})
+	}
+
+	s.tree.AnalyzeSymlink(e.path, fileInfo)
+
+	if s.opts.Visitor != nil {
+		s.opts.Visitor(fileInfo)
 	}
 }
-func (s *Scanner) ShouldSkipPath(path string) bool {
-	skipPaths := []string{
-		"/proc", "/sys", "/dev", "/run", "/tmp",
-		"/var/run", "/var/lock", "/var/tmp",
+
+// scanArchive lists the members of an archive file, passing each to the
+// visitor as if the archive were a directory.
+func (s *Scanner) scanArchive(file types.FileInfo, format string) {
+	stats := types.ArchiveStats{Path: file.Path, Format: format, Size: file.Size}
+	err := archive.WalkFS(s.fs, file.Path, func(m archive.Member) error {
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+		if m.IsDir {
+			stats.Dirs++
+		} else {
+			stats.Files++
+			stats.UncompressedSize += m.Size
+		}
+
+		if s.opts.Visitor != nil {
+			ext := ""
+			if !m.IsDir {
+				ext = types.ExtensionOf(path.Base(m.Name))
+			}
+			s.opts.Visitor(types.FileInfo{
+				Path:           filepath.Join(file.Path, filepath.FromSlash(m.Name)),
+				Size:           m.Size,
+				ModTime:        m.ModTime,
+				IsDir:          m.IsDir,
+				Extension:      ext,
+				Mode:           m.Mode,
+				Uid:            uint32(m.Uid),
+				Gid:            uint32(m.Gid),
+				Depth:          file.Depth + 1 + strings.Count(m.Name, "/"),
+				Archive:        file.Path,
+				CompressedSize: m.CompressedSize,
+				Owner:          m.Uname,
+				Group:          m.Gname,
+			})
+		}
+		return nil
+	})
+	if err != nil && s.ctx.Err() == nil {
+		stats.Error = err.Error()
+		s.addError(fmt.Sprintf("Error reading archive %s: %v", file.Path, err))
 	}
+	s.recorder.AddArchive(stats)
+}
+
+func (s *Scanner) statError(path string, err error) {
+	s.addError(fmt.Sprintf("Error getting info for %s: %v", path, err))
+}
 
-	for _, skipPath := range skipPaths {
-		if path == skipPath || filepath.HasPrefix(path, skipPath+"/") {
+// addError counts an error for the progress line and the analyzer's total,
+// and shows msg as the latest one.
+func (s *Scanner) addError(msg string) {
+	atomic.AddInt64(&s.errorCount, 1)
+	s.recorder.IncrementError()
+	s.setLastError(msg)
+}
+
+func newFileInfo(path string, info fs.FileInfo) types.FileInfo {
+	ext := ""
+	if !info.IsDir() && info.Mode()&fs.ModeSymlink == 0 {
+		ext = types.ExtensionOf(info.Name())
+	}
+
+	fileInfo := types.FileInfo{
+		Path:      path,
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		IsDir:     info.IsDir(),
+		Extension: ext,
+		Mode:      info.Mode(),
+		DiskUsage: info.Size(),
+	}
+	fillSysInfo(&fileInfo, info)
+	return fileInfo
+}
+
+// ShouldSkipPath reports whether path lies on a skipped filesystem type or
+// under one of the skipped path prefixes. The walker checks each directory
+// before descending into it.
+func (s *Scanner) ShouldSkipPath(path string) bool {
+	path = s.absPath(path)
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if reason, _ := s.rules.systemSkip(dir, true); reason != "" {
 			return true
 		}
+		if dir == filepath.Dir(dir) {
+			return false
+		}
 	}
-	return false
+}
+func (s *Scanner) skip(path, reason, fstype string, isDir bool) {
+	atomic.AddInt64(&s.skippedCount, 1)
+	s.recorder.AddSkipped(types.SkippedPath{Path: path, Reason: reason, FSType: fstype, IsDir: isDir})
 }
 func (s *Scanner) displayProgress() {
 	for {
@@ -201,22 +448,23 @@ func (s *Scanner) displayProgress() {
 			currentPath := s.getCurrentPath()
 			lastError := s.getLastError()
 
-			fmt.Printf("\r\033[K")
-			fmt.Printf("Scanned Files: %d | Dirs: %d | Errors: %d | Skipped: %d | Size: %s | Time: %v",
+			out := s.opts.ProgressWriter
+			fmt.Fprintf(out, "\r\033[K")
+			fmt.Fprintf(out, "Scanned Files: %d | Dirs: %d | Errors: %d | Skipped: %d | Size: %s | Time: %v",
 				files, dirs, errors, skipped, FormatBytes(bytes), elapsed.Truncate(time.Second))
 
 			if len(currentPath) > 0 {
 				if len(currentPath) > 80 {
 					currentPath = "..." + currentPath[len(currentPath)-77:]
 				}
-				fmt.Printf("\nCurrent: %s", currentPath)
+				fmt.Fprintf(out, "\nCurrent: %s", currentPath)
 			}
 
 			if len(lastError) > 0 && errors > 0 {
 				if len(lastError) > 80 {
 					lastError = lastError[:77] + "..."
 				}
-				fmt.Printf("\nLast Error: %s", lastError)
+				fmt.Fprintf(out, "\nLast Error: %s", lastError)
 			}
 
 			if len(currentPath) > 0 || len(lastError) > 0 {
@@ -227,7 +475,7 @@ func (s *Scanner) displayProgress() {
 				if len(lastError) > 0 {
 					lines++
 				}
-				fmt.Printf("\033[%dA", lines-1)
+				fmt.Fprintf(out, "\033[%dA", lines-1)
 			}
 
 		case <-s.ctx.Done():
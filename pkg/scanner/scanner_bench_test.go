@@ -0,0 +1,124 @@
+package scanner
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// makeTree creates a tree of dirs directories, each holding files small
+// files, nested a few levels deep so the walkers have subtrees to steal.
+func makeTree(tb testing.TB, dirs, files int) string {
+	tb.Helper()
+	root := tb.TempDir()
+	for d := 0; d < dirs; d++ {
+		dir := filepath.Join(root, fmt.Sprintf("a%d", d%4), fmt.Sprintf("b%d", d%16), fmt.Sprintf("c%d", d))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			tb.Fatal(err)
+		}
+		for f := 0; f < files; f++ {
+			name := filepath.Join(dir, fmt.Sprintf("file%d.txt", f))
+			if err := os.WriteFile(name, []byte("data"), 0o644); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+	return root
+}
+
+func BenchmarkScan(b *testing.B) {
+	root := makeTree(b, 200, 50)
+
+	for _, walkers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("walkers=%d", walkers), func(b *testing.B) {
+			var files int64
+			for i := 0; i < b.N; i++ {
+				s := NewScanner(
+					WithWalkers(walkers),
+					WithQuiet(true),
+					WithProgressWriter(io.Discard),
+					WithoutDefaultExcludes(),
+				)
+				files = s.Start(root).TotalFiles
+				s.Stop()
+			}
+			b.ReportMetric(float64(files), "files/op")
+		})
+	}
+}
+
+// statCountingFS is the OS filesystem, counting every call that fetches a
+// file's metadata, including the Info of the directory entries it lists.
+type statCountingFS struct {
+	OSFS
+	stats int64
+}
+
+func (c *statCountingFS) Lstat(name string) (fs.FileInfo, error) {
+	atomic.AddInt64(&c.stats, 1)
+	return c.OSFS.Lstat(name)
+}
+
+func (c *statCountingFS) Stat(name string) (fs.FileInfo, error) {
+	atomic.AddInt64(&c.stats, 1)
+	return c.OSFS.Stat(name)
+}
+
+func (c *statCountingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	dirents, err := c.OSFS.ReadDir(name)
+	for i, d := range dirents {
+		dirents[i] = countingDirEntry{d, &c.stats}
+	}
+	return dirents, err
+}
+
+type countingDirEntry struct {
+	fs.DirEntry
+	stats *int64
+}
+
+func (d countingDirEntry) Info() (fs.FileInfo, error) {
+	atomic.AddInt64(d.stats, 1)
+	return d.DirEntry.Info()
+}
+
+// scanCountingStats scans root through a statCountingFS and returns the
+// number of entries found and the metadata calls made for them.
+func scanCountingStats(root string) (entries, stats int64) {
+	fsys := &statCountingFS{}
+	s := NewScanner(
+		WithFS(fsys),
+		WithQuiet(true),
+		WithProgressWriter(io.Discard),
+		WithoutDefaultExcludes(),
+	)
+	defer s.Stop()
+	result := s.Start(root)
+	return result.TotalFiles + result.TotalDirs, atomic.LoadInt64(&fsys.stats)
+}
+
+// BenchmarkScanStats reports how many times each entry is stat'ed. Files
+// are stat'ed once, through their directory entry, rather than by the
+// walker and again by the worker.
+func BenchmarkScanStats(b *testing.B) {
+	root := makeTree(b, 200, 50)
+
+	var entries, stats int64
+	for i := 0; i < b.N; i++ {
+		entries, stats = scanCountingStats(root)
+	}
+	b.ReportMetric(float64(stats)/float64(entries), "stats/entry")
+}
+
+func TestScanStatsEachEntryOnce(t *testing.T) {
+	root := makeTree(t, 20, 10)
+
+	entries, stats := scanCountingStats(root)
+	if entries == 0 || stats > entries {
+		t.Errorf("%d metadata calls for %d entries, want at most one each", stats, entries)
+	}
+}
@@ -0,0 +1,507 @@
+// Package snapshot saves the entries of a scan to a compact file and loads
+// them back, so a scan can be looked at again, or compared with a later
+// one, without touching the filesystem.
+//
+// A snapshot starts with the magic string "FSSNAP", a NUL byte and a
+// format version byte, followed by a gzip stream. The stream holds one
+// record per entry, with integers written as varints and each path stored
+// as the length of the prefix it shares with the path before it plus the
+// rest. A zero byte ends the records; after it comes a length-prefixed
+// JSON summary of the parts of the result that can't be rebuilt from the
+// entries, such as skipped paths and broken links.
+//
+// Paths are stored absolute, so a snapshot means the same thing wherever
+// it is loaded or compared from.
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"file-counter/pkg/scanner"
+	"file-counter/pkg/scanner/analyzer"
+	"file-counter/pkg/scanner/types"
+)
+
+// Version is the format version written by Writer. Load refuses any other.
+const Version = 1
+
+const magic = "FSSNAP\x00"
+
+const (
+	recordEnd   = 0
+	recordEntry = 1
+)
+
+// maxJSON bounds the size of the summary Load is willing to read. Even the
+// largest scans skip far fewer paths than would fill it.
+const maxJSON = 64 << 20
+
+// summary is what a snapshot records besides its entries.
+type summary struct {
+	Created       time.Time
+	Duration      time.Duration
+	Errors        int64
+	SizeMode      string
+	MaxDepth      int
+	Roots         []types.RootStats
+	SkippedMounts []string
+	Skipped       []types.SkippedPath
+	Ignored       types.IgnoreStats
+	BrokenLinks   []types.BrokenLink
+	Archives      []types.ArchiveStats
+	Duplicates    *types.DuplicateStats
+	Options       scanOptions
+}
+
+// scanOptions are the scan options that decide which entries a scan
+// records, kept so the tree can be scanned again the same way.
+type scanOptions struct {
+	Symlinks          string
+	SkipDirs          []string
+	SkipPaths         []string
+	SkipFSTypes       []string
+	Excludes          []string
+	Includes          []string
+	NoDefaultExcludes bool
+	IgnoreFiles       []string
+	OneFileSystem     bool
+	Hash              string
+}
+
+// Writer streams scan entries into a snapshot.
+type Writer struct {
+	mu      sync.Mutex
+	gz      *gzip.Writer
+	buf     []byte
+	last    string
+	dir     string
+	created time.Time
+	err     error
+}
+
+// NewWriter writes the snapshot header to w and returns a Writer for the
+// entries. Relative paths are taken to be relative to the current
+// directory. The snapshot is only complete once Close has been called.
+func NewWriter(w io.Writer) (*Writer, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append([]byte(magic), Version)); err != nil {
+		return nil, err
+	}
+	return &Writer{gz: gzip.NewWriter(w), dir: dir, created: time.Now()}, nil
+}
+
+func (sw *Writer) abs(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(sw.dir, path)
+}
+
+// Add records one entry. Archive members are left out: they aren't part of
+// the scan totals, and the archives are summarized as a whole.
+func (sw *Writer) Add(info types.FileInfo) {
+	if info.Archive != "" {
+		return
+	}
+	info.Path = sw.abs(info.Path)
+
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if sw.err != nil {
+		return
+	}
+
+	shared := commonPrefix(sw.last, info.Path)
+	b := append(sw.buf[:0], recordEntry)
+	b = binary.AppendUvarint(b, uint64(shared))
+	b = appendString(b, info.Path[shared:])
+	b = binary.AppendUvarint(b, uint64(info.Mode))
+	b = binary.AppendVarint(b, info.Size)
+	b = binary.AppendVarint(b, info.DiskUsage)
+	b = binary.AppendVarint(b, info.ModTime.Unix())
+	b = binary.AppendUvarint(b, uint64(info.ModTime.Nanosecond()))
+	b = binary.AppendUvarint(b, uint64(info.Uid))
+	b = binary.AppendUvarint(b, uint64(info.Gid))
+	b = binary.AppendUvarint(b, info.Inode)
+	b = binary.AppendUvarint(b, info.Device)
+	b = binary.AppendUvarint(b, info.Links)
+	b = binary.AppendUvarint(b, uint64(info.Depth))
+	b = appendString(b, info.LinkTarget)
+	digest, _ := hex.DecodeString(info.Digest)
+	b = appendString(b, string(digest))
+	sw.buf = b
+
+	_, sw.err = sw.gz.Write(b)
+	sw.last = info.Path
+}
+
+// Close ends the entries, writes what else is needed to rebuild result and
+// to scan the tree again with opts, and flushes the compressed stream. It
+// doesn't close the underlying writer.
+func (sw *Writer) Close(result *types.ScanResult, opts scanner.Options) error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if sw.err != nil {
+		return sw.err
+	}
+
+	sum := sw.summary(result)
+	sum.Options = scanOptions{
+		Symlinks:          opts.Symlinks,
+		SkipDirs:          opts.SkipDirs,
+		SkipPaths:         opts.SkipPaths,
+		SkipFSTypes:       opts.SkipFSTypes,
+		Excludes:          opts.Excludes,
+		Includes:          opts.Includes,
+		NoDefaultExcludes: opts.NoDefaultExcludes,
+		IgnoreFiles:       opts.IgnoreFiles,
+		OneFileSystem:     opts.OneFileSystem,
+		Hash:              opts.Hash,
+	}
+	data, err := json.Marshal(sum)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxJSON {
+		return errors.New("scan summary too large to save")
+	}
+
+	b := binary.AppendUvarint([]byte{recordEnd}, uint64(len(data)))
+	if _, err := sw.gz.Write(append(b, data...)); err != nil {
+		return err
+	}
+	sw.err = errors.New("snapshot already closed")
+	return sw.gz.Close()
+}
+
+// summary copies what Close records of result, with absolute paths.
+func (sw *Writer) summary(result *types.ScanResult) summary {
+	sum := summary{
+		Created:  sw.created,
+		Duration: result.ScanDuration,
+		Errors:   result.TotalErrors,
+		SizeMode: result.SizeMode,
+		MaxDepth: result.MaxDepth,
+		Ignored:  result.Ignored,
+	}
+	for _, root := range result.Roots {
+		root.Path = sw.abs(root.Path)
+		if root.CoveredBy != "" {
+			root.CoveredBy = sw.abs(root.CoveredBy)
+		}
+		sum.Roots = append(sum.Roots, root)
+	}
+	for _, path := range result.SkippedMounts {
+		sum.SkippedMounts = append(sum.SkippedMounts, sw.abs(path))
+	}
+	for _, skipped := range result.Skipped {
+		skipped.Path = sw.abs(skipped.Path)
+		sum.Skipped = append(sum.Skipped, skipped)
+	}
+	for _, link := range result.BrokenLinks {
+		link.Path = sw.abs(link.Path)
+		sum.BrokenLinks = append(sum.BrokenLinks, link)
+	}
+	for _, archive := range result.Archives {
+		archive.Path = sw.abs(archive.Path)
+		sum.Archives = append(sum.Archives, archive)
+	}
+	if result.Duplicates != nil {
+		duplicates := *result.Duplicates
+		duplicates.Sets = nil
+		for _, set := range result.Duplicates.Sets {
+			paths := make([]string, len(set.Paths))
+			for i, path := range set.Paths {
+				paths[i] = sw.abs(path)
+			}
+			set.Paths = paths
+			duplicates.Sets = append(duplicates.Sets, set)
+		}
+		sum.Duplicates = &duplicates
+	}
+	return sum
+}
+
+// Snapshot is a loaded snapshot.
+type Snapshot struct {
+	// Created is when the scan started.
+	Created time.Time
+
+	// Entries holds every file, directory and link in the order the
+	// scan recorded them. Extension is filled in from the path.
+	Entries []types.FileInfo
+
+	summary summary
+}
+
+// ReadFile loads the snapshot in the named file.
+func ReadFile(name string) (*Snapshot, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	snap, err := Load(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return snap, nil
+}
+
+// Load reads a snapshot written by Writer.
+func Load(r io.Reader) (*Snapshot, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:len(magic)]) != magic {
+		return nil, errors.New("not a snapshot file")
+	}
+	if v := header[len(magic)]; v != Version {
+		return nil, fmt.Errorf("unsupported snapshot version %d", v)
+	}
+
+	var d decoder
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, d.fail(err)
+	}
+	defer gz.Close()
+
+	d.r = bufio.NewReader(gz)
+	snap := &Snapshot{}
+	var last string
+	for {
+		kind, err := d.r.ReadByte()
+		if err != nil {
+			return nil, d.fail(err)
+		}
+		if kind == recordEnd {
+			break
+		}
+		if kind != recordEntry {
+			return nil, fmt.Errorf("corrupt snapshot: unknown record type %d", kind)
+		}
+
+		shared := d.uvarint()
+		if shared > uint64(len(last)) {
+			return nil, errors.New("corrupt snapshot: bad path prefix")
+		}
+		var info types.FileInfo
+		info.Path = last[:shared] + d.string()
+		info.Mode = fs.FileMode(d.uvarint())
+		info.IsDir = info.Mode.IsDir()
+		info.Size = d.varint()
+		info.DiskUsage = d.varint()
+		sec := d.varint()
+		info.ModTime = time.Unix(sec, int64(d.uvarint()))
+		info.Uid = uint32(d.uvarint())
+		info.Gid = uint32(d.uvarint())
+		info.Inode = d.uvarint()
+		info.Device = d.uvarint()
+		info.Links = d.uvarint()
+		info.Depth = int(d.uvarint())
+		info.LinkTarget = d.string()
+		if digest := d.string(); digest != "" {
+			info.Digest = hex.EncodeToString([]byte(digest))
+		}
+		if d.err != nil {
+			return nil, d.fail(d.err)
+		}
+		if !info.IsDir && !info.IsSymlink() {
+			info.Extension = types.ExtensionOf(filepath.Base(info.Path))
+		}
+
+		snap.Entries = append(snap.Entries, info)
+		last = info.Path
+	}
+
+	n := d.uvarint()
+	if d.err == nil && n > maxJSON {
+		return nil, errors.New("corrupt snapshot: summary too large")
+	}
+	// Read it the way strings are read, so the length isn't trusted
+	// before the data is there.
+	var data bytes.Buffer
+	if d.err == nil {
+		_, d.err = io.CopyN(&data, d.r, int64(n))
+	}
+	if d.err != nil {
+		return nil, d.fail(d.err)
+	}
+	if err := json.Unmarshal(data.Bytes(), &snap.summary); err != nil {
+		return nil, fmt.Errorf("corrupt snapshot: %w", err)
+	}
+	// Reading to the end makes gzip check the stream's checksum.
+	switch _, err := d.r.ReadByte(); err {
+	case io.EOF:
+	case nil:
+		return nil, errors.New("corrupt snapshot: data after the summary")
+	default:
+		return nil, d.fail(err)
+	}
+	snap.Created = snap.summary.Created
+	return snap, nil
+}
+
+// Result replays the entries into sc and returns the result of the scan
+// the snapshot was taken from, ranked by sc's settings. The entries hold
+// both sizes and every depth, so any size mode and depth cutoff work. A nil
+// sc is a new collector set up like the scan was.
+func (s *Snapshot) Result(sc *analyzer.StatisticsCollector) *types.ScanResult {
+	if sc == nil {
+		sc = analyzer.NewStatisticsCollector()
+		sc.SetSizeMode(s.summary.SizeMode)
+		sc.SetMaxDepth(s.summary.MaxDepth)
+	}
+
+	// Covered roots come after the scanned ones, as in Scanner.Start.
+	for _, root := range s.summary.Roots {
+		if root.CoveredBy == "" {
+			sc.AddRoot(root.Path)
+		}
+	}
+	for _, root := range s.summary.Roots {
+		if root.CoveredBy != "" {
+			sc.AddCoveredRoot(root.Path, root.CoveredBy)
+		}
+	}
+
+	for _, info := range s.Entries {
+		switch {
+		case info.IsSymlink():
+			sc.AnalyzeSymlink(info.Path, info)
+		case info.IsDir:
+			sc.AnalyzeDirectory(info.Path, info)
+		default:
+			sc.AnalyzeFile(info.Path, info)
+		}
+	}
+
+	result := sc.GetResults()
+	result.ScanDuration = s.summary.Duration
+	result.FilesPerSecond, result.BytesPerSecond = 0, 0
+	if seconds := s.summary.Duration.Seconds(); seconds > 0 {
+		result.FilesPerSecond = float64(result.TotalFiles) / seconds
+		result.BytesPerSecond = float64(result.TotalSize) / seconds
+	}
+	result.TotalErrors = s.summary.Errors
+	result.SkippedMounts = s.summary.SkippedMounts
+	result.Skipped = s.summary.Skipped
+	result.Ignored = s.summary.Ignored
+	result.BrokenLinks = s.summary.BrokenLinks
+	result.Archives = s.summary.Archives
+	result.Duplicates = s.summary.Duplicates
+	return result
+}
+
+// SizeMode returns the size mode the scan ranked by.
+func (s *Snapshot) SizeMode() string {
+	return s.summary.SizeMode
+}
+
+// MaxDepth returns the scan's directory depth cutoff, or 0 if it had none.
+func (s *Snapshot) MaxDepth() int {
+	return s.summary.MaxDepth
+}
+
+// ScanOptions returns the options that make a scan leave out the same
+// entries the snapshot's scan did, treat links the same way and compute the
+// same digests. The rest are zero, for the caller to fill in.
+func (s *Snapshot) ScanOptions() scanner.Options {
+	o := s.summary.Options
+	return scanner.Options{
+		Symlinks:          o.Symlinks,
+		SkipDirs:          o.SkipDirs,
+		SkipPaths:         o.SkipPaths,
+		SkipFSTypes:       o.SkipFSTypes,
+		Excludes:          o.Excludes,
+		Includes:          o.Includes,
+		NoDefaultExcludes: o.NoDefaultExcludes,
+		IgnoreFiles:       o.IgnoreFiles,
+		OneFileSystem:     o.OneFileSystem,
+		Hash:              o.Hash,
+	}
+}
+
+// Roots returns the absolute paths the snapshot's scan started from.
+func (s *Snapshot) Roots() []string {
+	var roots []string
+	for _, root := range s.summary.Roots {
+		roots = append(roots, root.Path)
+	}
+	return roots
+}
+
+type decoder struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	var v uint64
+	v, d.err = binary.ReadUvarint(d.r)
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	var v int64
+	v, d.err = binary.ReadVarint(d.r)
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	// Grow the buffer as data arrives, so a corrupt length can't make
+	// us allocate more than the stream holds.
+	var b bytes.Buffer
+	_, d.err = io.CopyN(&b, d.r, int64(n))
+	return b.String()
+}
+
+// fail turns a premature end of the stream into a clearer error.
+func (d *decoder) fail(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errors.New("truncated snapshot")
+	}
+	return err
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func commonPrefix(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,225 @@
+package snapshot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"file-counter/pkg/scanner"
+	"file-counter/pkg/scanner/types"
+)
+
+var modTime = time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC)
+
+func testEntries() []types.FileInfo {
+	return []types.FileInfo{
+		{Path: "/data", IsDir: true, Mode: fs.ModeDir | 0o755, Size: 4096, DiskUsage: 4096, ModTime: modTime, Inode: 2, Device: 1, Links: 3},
+		{Path: "/data/a.txt", Mode: 0o644, Size: 10, DiskUsage: 4096, ModTime: modTime, Uid: 1000, Gid: 100, Inode: 3, Device: 1, Links: 1, Depth: 1, Extension: ".txt", Digest: "00ff10"},
+		{Path: "/data/sub", IsDir: true, Mode: fs.ModeDir | 0o700, Size: 4096, DiskUsage: 4096, ModTime: modTime, Inode: 4, Device: 1, Links: 2, Depth: 1},
+		{Path: "/data/sub/b.go", Mode: 0o600, Size: 20, DiskUsage: 8192, ModTime: modTime.Add(-time.Hour), Inode: 5, Device: 1, Links: 2, Depth: 2, Extension: ".go"},
+		{Path: "/data/sub/link", Mode: fs.ModeSymlink | 0o777, Size: 4, ModTime: modTime, Inode: 6, Device: 1, Links: 1, Depth: 2, LinkTarget: "b.go"},
+	}
+}
+
+func testResult() *types.ScanResult {
+	return &types.ScanResult{
+		SizeMode:      types.SizeDisk,
+		MaxDepth:      3,
+		TotalErrors:   1,
+		ScanDuration:  2 * time.Second,
+		Roots:         []types.RootStats{{Path: "/data"}},
+		SkippedMounts: []string{"/data/mnt"},
+		Skipped:       []types.SkippedPath{{Path: "/data/node_modules", Reason: types.SkipBuiltinRule, IsDir: true}},
+		BrokenLinks:   []types.BrokenLink{{Path: "/data/dead", Target: "nowhere", Reason: "no such file or directory"}},
+	}
+}
+
+func writeSnapshot(t *testing.T, entries []types.FileInfo, result *types.ScanResult, opts scanner.Options) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	sw, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, info := range entries {
+		sw.Add(info)
+	}
+	if err := sw.Close(result, opts); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	opts := scanner.Options{
+		Symlinks:    types.SymlinkFollow,
+		Excludes:    []string{"*.tmp"},
+		IgnoreFiles: []string{".gitignore"},
+		Hash:        "sha256",
+		Workers:     8,
+	}
+	data := writeSnapshot(t, testEntries(), testResult(), opts)
+
+	snap, err := Load(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := testEntries()
+	if len(snap.Entries) != len(want) {
+		t.Fatalf("loaded %d entries, want %d", len(snap.Entries), len(want))
+	}
+	for i, got := range snap.Entries {
+		if !got.ModTime.Equal(want[i].ModTime) {
+			t.Errorf("%s: ModTime = %v, want %v", got.Path, got.ModTime, want[i].ModTime)
+		}
+		got.ModTime = want[i].ModTime
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("entry %d =\n%+v\nwant\n%+v", i, got, want[i])
+		}
+	}
+
+	if got := snap.Roots(); !reflect.DeepEqual(got, []string{"/data"}) {
+		t.Errorf("Roots = %v, want [/data]", got)
+	}
+	if snap.SizeMode() != types.SizeDisk || snap.MaxDepth() != 3 {
+		t.Errorf("SizeMode, MaxDepth = %q, %d, want %q, 3", snap.SizeMode(), snap.MaxDepth(), types.SizeDisk)
+	}
+
+	// Only the options that decide what is scanned are kept.
+	wantOpts := scanner.Options{
+		Symlinks:    types.SymlinkFollow,
+		Excludes:    []string{"*.tmp"},
+		IgnoreFiles: []string{".gitignore"},
+		Hash:        "sha256",
+	}
+	if got := snap.ScanOptions(); !reflect.DeepEqual(got, wantOpts) {
+		t.Errorf("ScanOptions = %+v, want %+v", got, wantOpts)
+	}
+}
+
+func TestResult(t *testing.T) {
+	data := writeSnapshot(t, testEntries(), testResult(), scanner.Options{})
+	snap, err := Load(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := snap.Result(nil)
+	if result.TotalFiles != 2 || result.TotalDirs != 2 {
+		t.Errorf("TotalFiles, TotalDirs = %d, %d, want 2, 2", result.TotalFiles, result.TotalDirs)
+	}
+	if result.TotalSize != 30 || result.TotalDiskUsage != 4096+8192 {
+		t.Errorf("TotalSize, TotalDiskUsage = %d, %d, want 30, %d", result.TotalSize, result.TotalDiskUsage, 4096+8192)
+	}
+	if result.SizeMode != types.SizeDisk {
+		t.Errorf("SizeMode = %q, want %q", result.SizeMode, types.SizeDisk)
+	}
+	if result.LargestFile.Path != "/data/sub/b.go" {
+		t.Errorf("LargestFile = %s, want /data/sub/b.go", result.LargestFile.Path)
+	}
+
+	saved := testResult()
+	if result.TotalErrors != saved.TotalErrors || result.ScanDuration != saved.ScanDuration {
+		t.Errorf("TotalErrors, ScanDuration = %d, %v, want %d, %v", result.TotalErrors, result.ScanDuration, saved.TotalErrors, saved.ScanDuration)
+	}
+	if !reflect.DeepEqual(result.Skipped, saved.Skipped) || !reflect.DeepEqual(result.BrokenLinks, saved.BrokenLinks) ||
+		!reflect.DeepEqual(result.SkippedMounts, saved.SkippedMounts) {
+		t.Errorf("summary lists not restored:\n%+v\n%+v\n%+v", result.Skipped, result.BrokenLinks, result.SkippedMounts)
+	}
+}
+
+func TestRelativePathsAreStoredAbsolute(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []types.FileInfo{
+		{Path: "tree", IsDir: true, Mode: fs.ModeDir | 0o755},
+		{Path: filepath.Join("tree", "f.txt"), Mode: 0o644, Size: 1, Depth: 1},
+	}
+	result := &types.ScanResult{
+		Roots:   []types.RootStats{{Path: "tree"}, {Path: filepath.Join("tree", "f.txt"), CoveredBy: "tree"}},
+		Skipped: []types.SkippedPath{{Path: filepath.Join("tree", "x"), Reason: types.SkipUserExclude}},
+	}
+	snap, err := Load(bytes.NewReader(writeSnapshot(t, entries, result, scanner.Options{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := filepath.Join(dir, "tree")
+	if got := snap.Roots(); !reflect.DeepEqual(got, []string{root, filepath.Join(root, "f.txt")}) {
+		t.Errorf("Roots = %v", got)
+	}
+	if snap.Entries[1].Path != filepath.Join(root, "f.txt") {
+		t.Errorf("entry path = %s, want %s", snap.Entries[1].Path, filepath.Join(root, "f.txt"))
+	}
+	loaded := snap.Result(nil)
+	if loaded.Roots[1].CoveredBy != root || loaded.Skipped[0].Path != filepath.Join(root, "x") {
+		t.Errorf("summary paths not made absolute: %+v %+v", loaded.Roots, loaded.Skipped)
+	}
+}
+
+// gzipSnapshot builds a snapshot around a raw record stream.
+func gzipSnapshot(records []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(magic)
+	buf.WriteByte(Version)
+	gz := gzip.NewWriter(&buf)
+	gz.Write(records)
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestLoadCorrupt(t *testing.T) {
+	badJSON := binary.AppendUvarint([]byte{recordEnd}, 3)
+	badJSON = append(badJSON, "{x}"...)
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, "not a snapshot"},
+		{"other file", []byte("PK\x03\x04 not a snapshot at all"), "not a snapshot"},
+		{"newer version", append([]byte(magic), Version+1), "unsupported snapshot version"},
+		{"gzip header cut short", append([]byte(magic), Version, 0x1f, 0x8b), "truncated"},
+		{"not gzip", append([]byte(magic), append([]byte{Version}, strings.Repeat("x", 20)...)...), "gzip"},
+		{"no records", gzipSnapshot(nil), "truncated"},
+		{"unknown record", gzipSnapshot([]byte{9}), "unknown record type"},
+		{"bad prefix", gzipSnapshot([]byte{recordEntry, 5}), "bad path prefix"},
+		{"entry cut short", gzipSnapshot([]byte{recordEntry, 0, 3, 'a'}), "truncated"},
+		{"summary too long", gzipSnapshot(binary.AppendUvarint([]byte{recordEnd}, maxJSON+1)), "summary too large"},
+		{"summary cut short", gzipSnapshot(binary.AppendUvarint([]byte{recordEnd}, 100)), "truncated"},
+		{"summary length past the data", gzipSnapshot(binary.AppendUvarint([]byte{recordEnd}, maxJSON)), "truncated"},
+		{"bad summary", gzipSnapshot(badJSON), "corrupt snapshot"},
+		{"trailing data", gzipSnapshot(append(binary.AppendUvarint([]byte{recordEnd}, 2), "{}x"...)), "data after the summary"},
+	}
+	for _, tt := range tests {
+		_, err := Load(bytes.NewReader(tt.data))
+		if err == nil {
+			t.Errorf("%s: loaded without an error", tt.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %q doesn't mention %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestLoadTruncated(t *testing.T) {
+	data := writeSnapshot(t, testEntries(), testResult(), scanner.Options{})
+	for n := 0; n < len(data); n++ {
+		if _, err := Load(bytes.NewReader(data[:n])); err == nil {
+			t.Fatalf("snapshot cut to %d of %d bytes loaded without an error", n, len(data))
+		}
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package scanner
+
+import (
+	"os"
+
+	"file-counter/pkg/scanner/types"
+)
+
+func fillSysInfo(fi *types.FileInfo, info os.FileInfo) {}
+
+func deviceOf(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+func inodeOf(info os.FileInfo) (dev, ino uint64, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,42 @@
+//go:build unix
+
+package scanner
+
+import (
+	"os"
+	"syscall"
+
+	"file-counter/pkg/scanner/types"
+)
+
+func fillSysInfo(fi *types.FileInfo, info os.FileInfo) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	fi.Inode = uint64(st.Ino)
+	fi.Device = uint64(st.Dev)
+	fi.Links = uint64(st.Nlink)
+	fi.Uid = st.Uid
+	fi.Gid = st.Gid
+	// st_blocks is always in 512-byte units, whatever the filesystem's
+	// block size.
+	fi.DiskUsage = int64(st.Blocks) * 512
+}
+
+func deviceOf(info os.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
+
+// inodeOf returns the device and inode number behind info.
+func inodeOf(info os.FileInfo) (dev, ino uint64, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return uint64(st.Dev), uint64(st.Ino), true
+}
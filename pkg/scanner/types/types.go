@@ -1,6 +1,8 @@
 package types
 
 import (
+	"io/fs"
+	"strings"
 	"time"
 )
 
@@ -10,6 +12,75 @@ type FileInfo struct {
 	ModTime   time.Time
 	IsDir     bool
 	Extension string
+	Mode      fs.FileMode
+	Uid       uint32
+	Gid       uint32
+	Inode     uint64
+	Device    uint64
+	Links     uint64
+	DiskUsage int64
+
+	// Depth is how many levels below the scan root the entry is,
+	// counting the root itself as 0, so root/a/f.txt has depth 2.
+	Depth int
+
+	// LinkTarget is what a symbolic link points to. It is also set on
+	// entries reached by following a link.
+	LinkTarget string
+
+	// Archive is set on the members of an archive file to the archive's
+	// path, which Path starts with. CompressedSize is the member's size
+	// inside the archive, or -1 if the archive is compressed as a whole.
+	Archive        string
+	CompressedSize int64
+
+	// Owner and Group are the user and group names an archive member was
+	// stored with, if the archive records them. Other entries leave them
+	// empty and only have Uid and Gid.
+	Owner string
+	Group string
+
+	// Digest is the hex digest of a regular file's contents when hashing
+	// is enabled.
+	Digest string
+}
+
+func (f FileInfo) IsSymlink() bool {
+	return f.Mode&fs.ModeSymlink != 0
+}
+
+// FileID identifies a file by its device and inode numbers, which all hard
+// links to it share.
+type FileID struct {
+	Dev uint64
+	Ino uint64
+}
+
+func (f FileInfo) ID() FileID {
+	return FileID{Dev: f.Device, Ino: f.Inode}
+}
+
+// ExtensionOf returns the lower-cased extension of a file name, including
+// the dot. Names starting with a dot have none.
+func ExtensionOf(name string) string {
+	if idx := strings.LastIndex(name, "."); idx > 0 {
+		return strings.ToLower(name[idx:])
+	}
+	return ""
+}
+
+// Sizes can be reported as the apparent length of files or as the bytes
+// actually allocated for them on disk, like du --apparent-size versus du.
+const (
+	SizeApparent = "apparent"
+	SizeDisk     = "disk"
+)
+
+func (f FileInfo) SizeFor(mode string) int64 {
+	if mode == SizeDisk {
+		return f.DiskUsage
+	}
+	return f.Size
 }
 
 type DirectoryStats struct {
@@ -17,23 +88,178 @@ type DirectoryStats struct {
 	FileCount   int64
 	DirCount    int64
 	TotalSize   int64
+	DiskUsage   int64
 	AverageSize float64
+
+	// Recursive totals cover the whole subtree below Path.
+	RecursiveFileCount int64
+	RecursiveDirCount  int64
+	RecursiveSize      int64
+	RecursiveDiskUsage int64
+}
+
+func (d DirectoryStats) SizeFor(mode string) int64 {
+	if mode == SizeDisk {
+		return d.DiskUsage
+	}
+	return d.TotalSize
+}
+
+func (d DirectoryStats) RecursiveSizeFor(mode string) int64 {
+	if mode == SizeDisk {
+		return d.RecursiveDiskUsage
+	}
+	return d.RecursiveSize
+}
+
+// Directory rankings can be ordered by the bytes directly inside a directory
+// or by the bytes of its whole subtree.
+const (
+	DirSortDirect    = "direct"
+	DirSortRecursive = "recursive"
+)
+
+// HardLinkStats describes files that share an inode with another path. Only
+// the first path seen for each (device, inode) pair contributes bytes to the
+// totals; the rest are counted here instead.
+type HardLinkStats struct {
+	LinkedFiles           int64
+	UniqueInodes          int64
+	DuplicateLinks        int64
+	DeduplicatedBytes     int64
+	DeduplicatedDiskUsage int64
+}
+
+// Symbolic links can be left out, counted on their own without following
+// them, or followed to the file or directory they point at.
+const (
+	SymlinkSkip     = "skip"
+	SymlinkPhysical = "physical"
+	SymlinkFollow   = "follow"
+)
+
+// SymlinkStats counts symbolic links. Links and Bytes cover the links
+// themselves, which are never counted as files; Followed counts the links
+// whose targets were scanned in their place.
+type SymlinkStats struct {
+	Links    int64
+	Bytes    int64
+	Followed int64
+}
+
+// BrokenLink is a symbolic link whose target can't be reached. Reason is
+// the error from resolving it, such as a missing file or a loop.
+type BrokenLink struct {
+	Path   string
+	Target string
+	Reason string
+}
+
+// RootStats is the part of the totals found below one scan root. Dirs
+// includes the root itself.
+type RootStats struct {
+	Path      string
+	Files     int64
+	Dirs      int64
+	Size      int64
+	DiskUsage int64
+
+	// CoveredBy is set when the root lies inside, or repeats, another
+	// root and wasn't scanned on its own.
+	CoveredBy string
+}
+
+// ArchiveStats describes the contents of one archive file. Its members
+// aren't part of the scan totals, which already count the archive itself
+// at Size bytes.
+type ArchiveStats struct {
+	Path             string
+	Format           string
+	Files            int64
+	Dirs             int64
+	Size             int64
+	UncompressedSize int64
+	// Error is set if the archive couldn't be read to the end.
+	Error string
+}
+
+// DuplicateSet is a group of files with the same contents. WastedBytes is
+// the space every copy but one takes up.
+type DuplicateSet struct {
+	Size        int64
+	SHA256      string
+	Paths       []string
+	WastedBytes int64
+}
+
+// DuplicateStats sums up the duplicate sets found. Further paths to a file
+// already considered, such as hard links, aren't duplicates and are only
+// counted in HardLinksSkipped.
+type DuplicateStats struct {
+	Sets             []DuplicateSet
+	Files            int64
+	WastedBytes      int64
+	HardLinksSkipped int64
+	Errors           int64
+}
+
+// IgnoreStats counts the entries left out by .gitignore-style files. Dirs
+// are the ignored directories themselves; nothing below them is walked.
+type IgnoreStats struct {
+	Files int64
+	Dirs  int64
+	Bytes int64
+}
+
+// Reasons a path was left out before being walked.
+const (
+	SkipPseudoFS    = "pseudo-fs"
+	SkipFSType      = "filesystem type"
+	SkipUserExclude = "user exclude"
+	SkipBuiltinRule = "built-in rule"
+	SkipSymlinkLoop = "symlink loop"
+
+	// SkipAlreadyVisited is a directory reached again through a link
+	// that doesn't lead back to an ancestor. It was counted where it was
+	// read first.
+	SkipAlreadyVisited = "already visited"
+)
+
+type SkippedPath struct {
+	Path   string
+	Reason string
+	// FSType is set for mount points skipped because of their type.
+	FSType string
+	IsDir  bool
 }
 
 type ExtensionStats struct {
 	Extension   string
 	Count       int64
 	TotalSize   int64
+	DiskUsage   int64
 	AverageSize float64
 	Percentage  float64
 }
 
+func (e ExtensionStats) SizeFor(mode string) int64 {
+	if mode == SizeDisk {
+		return e.DiskUsage
+	}
+	return e.TotalSize
+}
+
 type ScanResult struct {
-	TotalFiles   int64
-	TotalDirs    int64
-	TotalSize    int64
-	TotalErrors  int64
-	ScanDuration time.Duration
+	TotalFiles     int64
+	TotalDirs      int64
+	TotalSize      int64
+	TotalDiskUsage int64
+	TotalErrors    int64
+	ScanDuration   time.Duration
+
+	// SizeMode is the size (SizeApparent or SizeDisk) used to pick the
+	// extremes and rank directories.
+	SizeMode string
 
 	LargestFile     FileInfo
 	SmallestFile    FileInfo
@@ -42,12 +268,48 @@ type ScanResult struct {
 	AverageFileSize float64
 
 	TopExtensions []ExtensionStats
+	Extensions    []ExtensionStats
 
 	TopDirectories []DirectoryStats
 
+	// Roots breaks the totals down by scan root, in the order given.
+	Roots []RootStats
+
+	HardLinks HardLinkStats
+
+	// SkippedMounts lists directories left out because they are on a
+	// different filesystem than the scan root.
+	SkippedMounts []string
+
+	Ignored IgnoreStats
+
+	Symlinks    SymlinkStats
+	BrokenLinks []BrokenLink
+
+	// Archives lists the archives looked into, largest contents first.
+	Archives []ArchiveStats
+
+	// Duplicates is only set when duplicate files were searched for.
+	Duplicates *DuplicateStats
+
+	// Skipped lists the paths (and, for directories, whole subtrees) the
+	// walker didn't enter, with the rule that caused it.
+	Skipped []SkippedPath
+
 	FilesPerSecond float64
 	BytesPerSecond float64
-	DepthStats     map[int]int64
+
+	// DepthStats counts files by their depth below the scan root.
+	// MaxDepth is the directory cutoff, or 0 if there was none.
+	DepthStats map[int]int64
+	MaxDepth   int
+}
+
+func (r *ScanResult) TotalSizeFor(mode string) int64 {
+	if mode == SizeDisk {
+		return r.TotalDiskUsage
+	}
+	return r.TotalSize
 }
 
 type FileAnalyzer interface {
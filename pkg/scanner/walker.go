@@ -0,0 +1,445 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"file-counter/pkg/scanner/ignore"
+	"file-counter/pkg/scanner/types"
+)
+
+// entry is what the walker hands to the workers: a path together with the
+// directory entry it was read from, so each file is stat'ed exactly once.
+// info is set when the walker already needed the metadata itself. When a
+// symbolic link is followed, info describes its target and followed is set;
+// linkErr holds the error if the target couldn't be reached.
+type entry struct {
+	path     string
+	dirent   fs.DirEntry
+	depth    int
+	info     fs.FileInfo
+	followed bool
+	linkErr  error
+}
+
+// entryInfo returns the entry's metadata, fetching it from the directory
+// entry if the walker didn't already. Entries that don't come from a
+// directory listing are stat'ed by path.
+func (s *Scanner) entryInfo(e entry) (fs.FileInfo, error) {
+	if e.info != nil {
+		return e.info, nil
+	}
+	if e.dirent == nil {
+		return s.lstat(e.path)
+	}
+	return e.dirent.Info()
+}
+
+// dirNode is a directory on the way from the root to a task, for telling a
+// link back to an ancestor from one to a directory read elsewhere.
+type dirNode struct {
+	id     types.FileID
+	parent *dirNode
+}
+
+// dirTask is a directory waiting to be read. depth is relative to the scan
+// root, which has depth 0. node is only set when links are followed.
+type dirTask struct {
+	path    string
+	absPath string
+	depth   int
+	ignore  *ignore.Stack
+	node    *dirNode
+}
+
+// linkTask is a link to a directory, waiting for the directories that
+// aren't reached through links to have been read.
+type linkTask struct {
+	entry  entry
+	task   dirTask
+	parent *dirNode
+}
+
+// dirQueue is one walker's deque. The owner pushes and pops at the back,
+// which keeps its walk roughly depth first; idle walkers steal from the
+// front, where the oldest and usually largest subtrees are.
+type dirQueue struct {
+	mu    sync.Mutex
+	tasks []dirTask
+}
+
+func (q *dirQueue) push(t dirTask) {
+	q.mu.Lock()
+	q.tasks = append(q.tasks, t)
+	q.mu.Unlock()
+}
+
+func (q *dirQueue) popBack() (dirTask, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.tasks) == 0 {
+		return dirTask{}, false
+	}
+	t := q.tasks[len(q.tasks)-1]
+	q.tasks = q.tasks[:len(q.tasks)-1]
+	return t, true
+}
+
+func (q *dirQueue) popFront() (dirTask, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.tasks) == 0 {
+		return dirTask{}, false
+	}
+	t := q.tasks[0]
+	q.tasks[0] = dirTask{}
+	q.tasks = q.tasks[1:]
+	return t, true
+}
+
+func (q *dirQueue) empty() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.tasks) == 0
+}
+
+// walker reads directories with a pool of goroutines and sends every entry
+// it doesn't skip to entries. Entries are never stat'ed here unless a rule
+// needs their metadata; the workers do that, reusing anything fetched here.
+type walker struct {
+	s        *Scanner
+	root     string
+	rootDev  uint64
+	checkDev bool
+	entries  chan<- entry
+
+	queues  []*dirQueue
+	pending int64 // tasks queued or being read
+	idle    int32 // walkers waiting for work
+	idleMu  sync.Mutex
+	wake    *sync.Cond
+
+	// visited holds every directory read so far when links are followed,
+	// so a link back to an ancestor or to a tree already walked is read
+	// only once. It is nil otherwise. Links to directories wait in links
+	// until everything else has been read, so a directory is always
+	// counted under its own path when the walk reaches it, whatever order
+	// the entries come in.
+	visitedMu sync.Mutex
+	visited   map[types.FileID]bool
+	links     []linkTask
+}
+
+func (s *Scanner) walkDirectory(root string, entries chan<- entry) {
+	info, err := s.lstat(root)
+	if err != nil {
+		s.addError(fmt.Sprintf("Error accessing %s: %v", root, err))
+		return
+	}
+
+	e := entry{path: root, info: info}
+	if info.Mode()&fs.ModeSymlink != 0 && s.opts.Symlinks == types.SymlinkFollow {
+		e = s.follow(root, nil)
+		if e.linkErr == nil {
+			info = e.info
+		}
+	}
+
+	s.setCurrentPath(root)
+	select {
+	case entries <- e:
+	case <-s.ctx.Done():
+		return
+	}
+	if !info.IsDir() {
+		return
+	}
+
+	absRoot := s.absPath(root)
+
+	w := &walker{
+		s:       s,
+		root:    root,
+		entries: entries,
+		queues:  make([]*dirQueue, s.opts.Walkers),
+	}
+	w.wake = sync.NewCond(&w.idleMu)
+	for i := range w.queues {
+		w.queues[i] = &dirQueue{}
+	}
+	if s.opts.OneFileSystem {
+		w.rootDev, w.checkDev = deviceOf(info)
+	}
+	var rootNode *dirNode
+	if s.opts.Symlinks == types.SymlinkFollow {
+		w.visited = make(map[types.FileID]bool)
+		if id, ok := dirID(info); ok {
+			w.claim(id)
+			rootNode = &dirNode{id: id}
+		}
+	}
+
+	stop := context.AfterFunc(s.ctx, func() {
+		w.idleMu.Lock()
+		w.wake.Broadcast()
+		w.idleMu.Unlock()
+	})
+	defer stop()
+
+	w.push(0, dirTask{path: root, absPath: absRoot, node: rootNode})
+	w.walk()
+
+	// Each round of links can lead to more links.
+	for w.visited != nil && s.ctx.Err() == nil {
+		links := w.takeLinks()
+		if len(links) == 0 {
+			return
+		}
+		sort.Slice(links, func(i, j int) bool {
+			return links[i].entry.path < links[j].entry.path
+		})
+		for _, l := range links {
+			task := l.task
+			if id, ok := dirID(l.entry.info); ok {
+				if !w.claim(id) {
+					s.skip(l.entry.path, revisitReason(id, l.parent), "", true)
+					continue
+				}
+				task.node = &dirNode{id: id, parent: l.parent}
+			}
+			select {
+			case entries <- l.entry:
+			case <-s.ctx.Done():
+				return
+			}
+			w.push(0, task)
+		}
+		w.walk()
+	}
+}
+
+// walk reads the queued directories, and everything found below them,
+// with all walkers.
+func (w *walker) walk() {
+	var wg sync.WaitGroup
+	for i := range w.queues {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			w.run(id)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// follow resolves the symbolic link at path. If the target can't be
+// reached, the returned entry describes the link itself and carries the
+// error.
+func (s *Scanner) follow(path string, dirent fs.DirEntry) entry {
+	info, err := s.stat(path)
+	if err != nil {
+		return entry{path: path, dirent: dirent, linkErr: err}
+	}
+	return entry{path: path, dirent: dirent, info: info, followed: true}
+}
+
+func dirID(info fs.FileInfo) (types.FileID, bool) {
+	dev, ino, ok := inodeOf(info)
+	return types.FileID{Dev: dev, Ino: ino}, ok
+}
+
+// claim reports whether the directory id hasn't been read yet, and marks
+// it as read.
+func (w *walker) claim(id types.FileID) bool {
+	w.visitedMu.Lock()
+	defer w.visitedMu.Unlock()
+	if w.visited[id] {
+		return false
+	}
+	w.visited[id] = true
+	return true
+}
+
+func (w *walker) deferLink(l linkTask) {
+	w.visitedMu.Lock()
+	w.links = append(w.links, l)
+	w.visitedMu.Unlock()
+}
+
+func (w *walker) takeLinks() []linkTask {
+	w.visitedMu.Lock()
+	defer w.visitedMu.Unlock()
+	links := w.links
+	w.links = nil
+	return links
+}
+
+// revisitReason tells whether a directory read already is an ancestor of
+// parent, making the way back to it a loop, or was read somewhere else.
+func revisitReason(id types.FileID, parent *dirNode) string {
+	for n := parent; n != nil; n = n.parent {
+		if n.id == id {
+			return types.SkipSymlinkLoop
+		}
+	}
+	return types.SkipAlreadyVisited
+}
+
+func (w *walker) push(id int, t dirTask) {
+	atomic.AddInt64(&w.pending, 1)
+	w.queues[id].push(t)
+	if atomic.LoadInt32(&w.idle) > 0 {
+		w.idleMu.Lock()
+		w.wake.Signal()
+		w.idleMu.Unlock()
+	}
+}
+
+func (w *walker) next(id int) (dirTask, bool) {
+	if t, ok := w.queues[id].popBack(); ok {
+		return t, true
+	}
+	for i := 1; i < len(w.queues); i++ {
+		if t, ok := w.queues[(id+i)%len(w.queues)].popFront(); ok {
+			return t, true
+		}
+	}
+	return dirTask{}, false
+}
+
+func (w *walker) hasWork() bool {
+	for _, q := range w.queues {
+		if !q.empty() {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *walker) run(id int) {
+	for {
+		t, ok := w.next(id)
+		if !ok {
+			w.idleMu.Lock()
+			atomic.AddInt32(&w.idle, 1)
+			for atomic.LoadInt64(&w.pending) > 0 && !w.hasWork() && w.s.ctx.Err() == nil {
+				w.wake.Wait()
+			}
+			atomic.AddInt32(&w.idle, -1)
+			done := atomic.LoadInt64(&w.pending) == 0 || w.s.ctx.Err() != nil
+			w.idleMu.Unlock()
+			if done {
+				return
+			}
+			continue
+		}
+
+		w.readDir(id, t)
+
+		if atomic.AddInt64(&w.pending, -1) == 0 {
+			w.idleMu.Lock()
+			w.wake.Broadcast()
+			w.idleMu.Unlock()
+		}
+	}
+}
+
+func (w *walker) readDir(id int, t dirTask) {
+	s := w.s
+
+	dirents, err := s.readDir(t.path)
+	if err != nil {
+		s.addError(fmt.Sprintf("Error accessing %s: %v", t.path, err))
+	}
+
+	stack := t.ignore
+	if len(s.opts.IgnoreFiles) > 0 {
+		matcher, err := ignore.LoadFS(s.fs, t.path, s.opts.IgnoreFiles)
+		if err != nil {
+			s.addError(fmt.Sprintf("Error reading ignore files in %s: %v", t.path, err))
+		}
+		stack = stack.Push(matcher)
+	}
+
+	s.setCurrentPath(t.path)
+	depth := t.depth + 1
+
+	for _, dirent := range dirents {
+		if s.ctx.Err() != nil {
+			return
+		}
+
+		path := filepath.Join(t.path, dirent.Name())
+		absPath := filepath.Join(t.absPath, dirent.Name())
+		isDir := dirent.IsDir()
+
+		e := entry{path: path, dirent: dirent, depth: depth}
+		if dirent.Type()&fs.ModeSymlink != 0 {
+			switch s.opts.Symlinks {
+			case types.SymlinkSkip:
+				continue
+			case types.SymlinkFollow:
+				e = s.follow(path, dirent)
+				e.depth = depth
+				isDir = e.info != nil && e.info.IsDir()
+			}
+		}
+
+		if reason, fstype := s.rules.skip(w.root, path, absPath, isDir); reason != "" {
+			s.skip(path, reason, fstype, isDir)
+			continue
+		}
+
+		if stack.Ignored(path, isDir) {
+			var size int64
+			if !isDir {
+				if info, err := s.entryInfo(e); err == nil {
+					size = info.Size()
+				}
+			}
+			atomic.AddInt64(&s.skippedCount, 1)
+			s.recorder.AddIgnored(isDir, size)
+			continue
+		}
+
+		task := dirTask{path: path, absPath: absPath, depth: depth, ignore: stack}
+		if isDir && (w.checkDev || w.visited != nil) {
+			if info, err := s.entryInfo(e); err == nil {
+				e.info = info
+				if dev, ok := deviceOf(info); w.checkDev && ok && dev != w.rootDev {
+					atomic.AddInt64(&s.skippedCount, 1)
+					s.recorder.AddSkippedMount(path)
+					continue
+				}
+				if w.visited != nil {
+					if e.followed {
+						w.deferLink(linkTask{entry: e, task: task, parent: t.node})
+						continue
+					}
+					if id, ok := dirID(info); ok {
+						if !w.claim(id) {
+							s.skip(path, revisitReason(id, t.node), "", true)
+							continue
+						}
+						task.node = &dirNode{id: id, parent: t.node}
+					}
+				}
+			}
+		}
+
+		select {
+		case w.entries <- e:
+		case <-s.ctx.Done():
+			return
+		}
+
+		if isDir {
+			w.push(id, task)
+		}
+	}
+}